@@ -8,13 +8,23 @@ import (
 
 // Definition of the configuration struct to house our config values for the program.
 type Configuration struct {
-	GcpCredentialsFile   string
-	AuthTokenFile        string
-	GoogleSheetsIdsFile  string
-	EquityTypes          []string
-	MongoDbConnectionUri string
-	MongoDbName          string
-	WebServerPort        string
+	GcpCredentialsFile        string
+	AuthTokenFile             string
+	GoogleSheetsIdsFile       string
+	EquityTypes               []string
+	Store                     string
+	EmbeddedStoreFile         string
+	MongoDbConnectionUri      string
+	MongoDbName               string
+	WebServerPort             string
+	MarketDataProvider        string
+	YahooFinanceScript        string
+	MarketDataDirectory       string
+	MarketDataRecordDirectory string
+	CostBasisMethods          map[string]string
+	AutoPopulateSplits        bool
+	RiskFreeRate              float64
+	Benchmarks                map[string]map[string]float64
 }
 
 // Constructor to create a new config object from the JSON config file.
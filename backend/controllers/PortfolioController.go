@@ -1,14 +1,19 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/kfwalther/Polly/backend/auth"
 	"github.com/kfwalther/Polly/backend/config"
@@ -21,29 +26,38 @@ type PortfolioController struct {
 	equityCatalogues     map[string]*finance.EquityCatalogue
 	fullPortfolioSummary *finance.PortfolioSummary
 	oauthHandler         *auth.OAuthHandler
-	dbClient             *data.MongoDbClient
+	store                data.Store
 	googleSheetMgr       *finance.GoogleSheetManager
 	googleSheetIdsFile   string
-	yfinPythonScriptFile string
+	marketData           finance.MarketDataProvider
+	costBasisMethods     map[string]string
+	autoPopulateSplits   bool
+	riskFreeRate         float64
+	fullRiskMetrics      finance.RiskMetrics
+	fullPeriodicReturns  finance.PeriodicReturns
+	benchmarks           []*finance.Benchmark
 }
 
 // Constructor for the controller for interfacing with the front-end.
-func NewPortfolioController(oauthHandler *auth.OAuthHandler, googleSheetIdsFile string, pyScript string) *PortfolioController {
+func NewPortfolioController(oauthHandler *auth.OAuthHandler, googleSheetIdsFile string, marketData finance.MarketDataProvider, store data.Store) *PortfolioController {
 	var ctrlr PortfolioController
 	ctrlr.equityCatalogues = make(map[string]*finance.EquityCatalogue)
 	ctrlr.oauthHandler = oauthHandler
 	ctrlr.googleSheetIdsFile = googleSheetIdsFile
-	ctrlr.yfinPythonScriptFile = pyScript
+	ctrlr.marketData = marketData
+	ctrlr.store = store
 	ctrlr.fullPortfolioSummary = finance.NewPortfolioSummary()
 	return &ctrlr
 }
 
-// Initialize the MongoDB client, and attempt to get our Sheet API auth token.
+// Apply the server configuration, and attempt to get our Sheet API auth token.
 func (c *PortfolioController) Init(config *config.Configuration) {
-	// Connect to our MongoDB instance.
-	c.dbClient = data.NewMongoDbClient()
-	c.dbClient.ConnectMongoDb(config.MongoDbConnectionUri, config.MongoDbName)
 	c.equityTypes = config.EquityTypes
+	c.costBasisMethods = config.CostBasisMethods
+	c.autoPopulateSplits = config.AutoPopulateSplits
+	c.riskFreeRate = config.RiskFreeRate
+	c.loadBenchmarks(config.Benchmarks)
+	c.loadCorporateActions()
 	// If valid OAuth token received, we can initialize here. Otherwise, wait for redirect callback.
 	if httpClient := c.oauthHandler.GetHttpClient(); httpClient != nil {
 		c.CreatePortfolioCatalogueAndProcess(httpClient)
@@ -57,16 +71,30 @@ func (c *PortfolioController) CreatePortfolioCatalogueAndProcess(httpClient *htt
 	c.googleSheetMgr = finance.NewGoogleSheetManager(httpClient, &ctx, c.googleSheetIdsFile)
 	for _, equityType := range c.equityTypes {
 		// Create the new equity catalogues to house our portfolio data.
-		catalogue := finance.NewEquityCatalogue(equityType, c.googleSheetMgr, c.dbClient, c.yfinPythonScriptFile)
+		catalogue := finance.NewEquityCatalogue(equityType, c.googleSheetMgr, c.store, c.marketData)
+		// Apply the configured cost basis method for this portfolio, if any (defaults to FIFO).
+		if method, ok := c.costBasisMethods[equityType]; ok {
+			if err := catalogue.SetCostBasisMethod(method); err != nil {
+				log.Fatalf("Unable to set cost basis method for %s portfolio: %v", equityType, err)
+			}
+		}
+		catalogue.SetRiskFreeRate(c.riskFreeRate)
+		catalogue.SetBenchmarks(c.benchmarks)
 		// Read from portfolio transactions sheets.
 		txns := c.googleSheetMgr.GetTransactionData(equityType)
 		// Process the imported data to organize it by ticker.
 		catalogue.ProcessImport(txns.Values)
 		log.Printf("Number of %s transactions processed: %d", equityType, len(txns.Values))
+		c.populateSplitHistory(catalogue)
 		// Calculate metrics for each catalogue's holdings.
 		catalogue.Calculate()
+		c.saveSnapshot(catalogue)
 		c.equityCatalogues[equityType] = catalogue
 	}
+	// Each catalogue builds the same benchmark histories, so use the first one's for the full portfolio.
+	if len(c.equityTypes) > 0 {
+		c.benchmarks = c.equityCatalogues[c.equityTypes[0]].GetBenchmarks()
+	}
 	c.CalculatePortfolioSummaryMetrics()
 }
 
@@ -154,6 +182,676 @@ func (c *PortfolioController) GetTransactions(ctx *gin.Context) {
 	}
 }
 
+// Build the realized gains report for the given tax year across all equity catalogues.
+func (c *PortfolioController) getRealizedGainsReport(yearStr string) (*finance.RealizedGainsReport, error) {
+	year, err := strconv.Atoi(yearStr)
+	if err != nil {
+		return nil, err
+	}
+	var lots []finance.ClosedLot
+	for _, equityType := range c.equityTypes {
+		if catalogue, ok := c.equityCatalogues[equityType]; ok {
+			lots = append(lots, catalogue.GetClosedLots()...)
+		}
+	}
+	return finance.NewRealizedGainsReport(year, lots), nil
+}
+
+// Send the short-term and long-term realized gains for the given tax year, portfolio-wide and per equity.
+func (c *PortfolioController) GetRealizedGains(ctx *gin.Context, yearStr string) {
+	report, err := c.getRealizedGainsReport(yearStr)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid tax year (" + yearStr + ")!",
+		})
+		return
+	}
+	log.Printf("Sending %d realized gain lots for %d to front-end...", len(report.Lots), report.Year)
+	ctx.JSON(200, gin.H{
+		"gains": report,
+	})
+}
+
+// Send the closed lots for the given tax year as a Form 8949-style CSV file.
+func (c *PortfolioController) GetForm8949Export(ctx *gin.Context, yearStr string) {
+	report, err := c.getRealizedGainsReport(yearStr)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid tax year (" + yearStr + ")!",
+		})
+		return
+	}
+	var csvData bytes.Buffer
+	if err = finance.WriteForm8949Csv(&csvData, report); err != nil {
+		log.Printf("WARNING: Unable to write Form 8949 export: %v", err)
+		ctx.JSON(500, gin.H{
+			"error": "Unable to write Form 8949 export!",
+		})
+		return
+	}
+	log.Printf("Sending Form 8949 export with %d lots for %d to front-end...", len(report.Lots), report.Year)
+	ctx.Header("Content-Disposition", "attachment; filename=form8949-"+yearStr+".csv")
+	ctx.Data(200, "text/csv", csvData.Bytes())
+}
+
+// Send the open lots across all portfolios with unrealized losses of at least the minimum (e.g. minLoss=500, in $,
+// defaulting to any loss), as tax-loss harvesting candidates, largest loss first.
+func (c *PortfolioController) GetHarvestCandidates(ctx *gin.Context) {
+	minLoss, err := strconv.ParseFloat(ctx.DefaultQuery("minLoss", "0"), 64)
+	if err != nil || minLoss < 0 {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid minimum loss (" + ctx.Query("minLoss") + ")!",
+		})
+		return
+	}
+	var eqs []*finance.Equity
+	for _, catalogue := range c.equityCatalogues {
+		eqs = append(eqs, catalogue.GetEquityList()...)
+	}
+	report := finance.FindHarvestCandidates(eqs, minLoss, time.Now())
+	log.Printf("Sending %d tax-loss harvesting candidates to front-end...", len(report.Candidates))
+	ctx.JSON(200, gin.H{
+		"harvest": report,
+	})
+}
+
+// Read the corporate actions store (seeding it with the defaults if empty), and apply it to all equity catalogues.
+func (c *PortfolioController) loadCorporateActions() {
+	actions, err := c.store.GetCorporateActions()
+	if err != nil {
+		log.Printf("WARNING: Unable to read corporate actions, using defaults: %v", err)
+		finance.SetCorporateActions(finance.DefaultCorporateActions)
+		return
+	}
+	if len(actions) == 0 {
+		log.Printf("Seeding corporate actions store with %d default actions...", len(finance.DefaultCorporateActions))
+		for _, action := range finance.DefaultCorporateActions {
+			if err = c.store.InsertCorporateAction(&action); err != nil {
+				log.Printf("WARNING: Unable to store corporate action for %s: %v", action.Ticker, err)
+			}
+			actions = append(actions, action)
+		}
+	}
+	finance.SetCorporateActions(actions)
+}
+
+// Add any splits reported by the market data provider for the catalogue's equities to the corporate actions store.
+func (c *PortfolioController) populateSplitHistory(catalogue *finance.EquityCatalogue) {
+	if !c.autoPopulateSplits {
+		return
+	}
+	added := 0
+	for _, action := range catalogue.RetrieveSplitHistory() {
+		inserted, err := c.store.InsertCorporateActionIfMissing(&action)
+		if err != nil {
+			log.Printf("WARNING: Unable to store split for %s: %v", action.Ticker, err)
+		} else if inserted {
+			added++
+		}
+	}
+	if added > 0 {
+		log.Printf("Added %d splits from market data to corporate actions store", added)
+		c.loadCorporateActions()
+	}
+}
+
+// Send the corporate actions (splits, delistings, renames) in the store to the front-end.
+func (c *PortfolioController) GetCorporateActions(ctx *gin.Context) {
+	actions, err := c.store.GetCorporateActions()
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "Unable to read corporate actions: " + err.Error(),
+		})
+		return
+	}
+	log.Printf("Sending %d corporate actions to front-end...", len(actions))
+	ctx.JSON(200, gin.H{
+		"corporateActions": actions,
+	})
+}
+
+// Add a new corporate action to the store. Takes effect on the next portfolio refresh.
+func (c *PortfolioController) CreateCorporateAction(ctx *gin.Context) {
+	var action data.CorporateAction
+	if err := ctx.ShouldBindJSON(&action); err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid corporate action: " + err.Error(),
+		})
+		return
+	}
+	action.ID = primitive.NilObjectID
+	if err := action.Validate(); err != nil {
+		ctx.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := c.store.InsertCorporateAction(&action); err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "Unable to store corporate action: " + err.Error(),
+		})
+		return
+	}
+	c.loadCorporateActions()
+	ctx.JSON(200, gin.H{
+		"corporateAction": action,
+	})
+}
+
+// Replace the corporate action with the given ID. Takes effect on the next portfolio refresh.
+func (c *PortfolioController) UpdateCorporateAction(ctx *gin.Context, idStr string) {
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid corporate action ID (" + idStr + ")!",
+		})
+		return
+	}
+	var action data.CorporateAction
+	if err = ctx.ShouldBindJSON(&action); err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid corporate action: " + err.Error(),
+		})
+		return
+	}
+	action.ID = id
+	if err = action.Validate(); err != nil {
+		ctx.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err = c.store.UpdateCorporateAction(action); errors.Is(err, data.ErrNotFound) {
+		ctx.JSON(404, gin.H{
+			"error": "No corporate action found with ID " + idStr,
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "Unable to update corporate action: " + err.Error(),
+		})
+		return
+	}
+	c.loadCorporateActions()
+	ctx.JSON(200, gin.H{
+		"corporateAction": action,
+	})
+}
+
+// Remove the corporate action with the given ID. Takes effect on the next portfolio refresh.
+func (c *PortfolioController) DeleteCorporateAction(ctx *gin.Context, idStr string) {
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid corporate action ID (" + idStr + ")!",
+		})
+		return
+	}
+	if err = c.store.DeleteCorporateAction(id); errors.Is(err, data.ErrNotFound) {
+		ctx.JSON(404, gin.H{
+			"error": "No corporate action found with ID " + idStr,
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "Unable to delete corporate action: " + err.Error(),
+		})
+		return
+	}
+	c.loadCorporateActions()
+	ctx.JSON(200, gin.H{
+		"deleted": idStr,
+	})
+}
+
+// Send the target allocations in the store to the front-end.
+func (c *PortfolioController) GetAllocationTargets(ctx *gin.Context) {
+	targets, err := c.store.GetAllocationTargets()
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "Unable to read allocation targets: " + err.Error(),
+		})
+		return
+	}
+	log.Printf("Sending %d allocation targets to front-end...", len(targets))
+	ctx.JSON(200, gin.H{
+		"targets": targets,
+	})
+}
+
+// Add a new target allocation to the store.
+func (c *PortfolioController) CreateAllocationTarget(ctx *gin.Context) {
+	var target data.AllocationTarget
+	if err := ctx.ShouldBindJSON(&target); err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid allocation target: " + err.Error(),
+		})
+		return
+	}
+	target.ID = primitive.NilObjectID
+	if err := target.Validate(); err != nil {
+		ctx.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := c.store.InsertAllocationTarget(&target); err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "Unable to store allocation target: " + err.Error(),
+		})
+		return
+	}
+	ctx.JSON(200, gin.H{
+		"target": target,
+	})
+}
+
+// Replace the target allocation with the given ID.
+func (c *PortfolioController) UpdateAllocationTarget(ctx *gin.Context, idStr string) {
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid allocation target ID (" + idStr + ")!",
+		})
+		return
+	}
+	var target data.AllocationTarget
+	if err = ctx.ShouldBindJSON(&target); err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid allocation target: " + err.Error(),
+		})
+		return
+	}
+	target.ID = id
+	if err = target.Validate(); err != nil {
+		ctx.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err = c.store.UpdateAllocationTarget(target); errors.Is(err, data.ErrNotFound) {
+		ctx.JSON(404, gin.H{
+			"error": "No allocation target found with ID " + idStr,
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "Unable to update allocation target: " + err.Error(),
+		})
+		return
+	}
+	ctx.JSON(200, gin.H{
+		"target": target,
+	})
+}
+
+// Remove the target allocation with the given ID.
+func (c *PortfolioController) DeleteAllocationTarget(ctx *gin.Context, idStr string) {
+	id, err := primitive.ObjectIDFromHex(idStr)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid allocation target ID (" + idStr + ")!",
+		})
+		return
+	}
+	if err = c.store.DeleteAllocationTarget(id); errors.Is(err, data.ErrNotFound) {
+		ctx.JSON(404, gin.H{
+			"error": "No allocation target found with ID " + idStr,
+		})
+		return
+	} else if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "Unable to delete allocation target: " + err.Error(),
+		})
+		return
+	}
+	ctx.JSON(200, gin.H{
+		"deleted": idStr,
+	})
+}
+
+// Send the drift of the given portfolio from the stored targets of a scope (scope=Ticker, Sector or EquityType),
+// and the trades to return to target using its cash balance. Trades below a minimum size (e.g. minTrade=100, in $,
+// defaulting to none) can be skipped, and sells avoided to only invest the cash (noSells=true).
+func (c *PortfolioController) GetRebalance(ctx *gin.Context, equityType string) {
+	scope := ctx.DefaultQuery("scope", data.AllocationScopeTicker)
+	minTrade, err := strconv.ParseFloat(ctx.DefaultQuery("minTrade", "0"), 64)
+	if err != nil || minTrade < 0 {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid minimum trade size (" + ctx.Query("minTrade") + ")!",
+		})
+		return
+	}
+	noSells, err := strconv.ParseBool(ctx.DefaultQuery("noSells", "false"))
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid no sells option (" + ctx.Query("noSells") + ")!",
+		})
+		return
+	}
+	var eqs []*finance.Equity
+	if equityType == "full" {
+		for _, catalogue := range c.equityCatalogues {
+			eqs = append(eqs, catalogue.GetEquityList()...)
+		}
+	} else if catalogue, ok := c.equityCatalogues[equityType]; ok {
+		eqs = catalogue.GetEquityList()
+	} else {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid equity type (" + equityType + ")!",
+		})
+		return
+	}
+	targets, err := c.store.GetAllocationTargets()
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "Unable to read allocation targets: " + err.Error(),
+		})
+		return
+	}
+	rebalance, err := finance.CalculateRebalance(eqs, targets, scope, minTrade, noSells)
+	if err != nil {
+		ctx.JSON(400, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("Sending %d %s rebalancing trades to front-end...", len(rebalance.Trades), equityType)
+	ctx.JSON(200, gin.H{
+		"rebalance": rebalance,
+	})
+}
+
+// Send the risk metrics of the given portfolio's holdings, and of each equity in it.
+func (c *PortfolioController) GetRiskMetrics(ctx *gin.Context, equityType string) {
+	var risk finance.RiskMetrics
+	equityRisk := make(map[string]finance.RiskMetrics)
+	if equityType == "full" {
+		risk = c.fullRiskMetrics
+		for _, catalogue := range c.equityCatalogues {
+			for _, s := range catalogue.GetEquityList() {
+				if s.Ticker != "CASH" {
+					equityRisk[s.Ticker] = s.Risk
+				}
+			}
+		}
+	} else if catalogue, ok := c.equityCatalogues[equityType]; ok {
+		risk = catalogue.GetRiskMetrics()
+		for _, s := range catalogue.GetEquityList() {
+			if s.Ticker != "CASH" {
+				equityRisk[s.Ticker] = s.Risk
+			}
+		}
+	} else {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid equity type (" + equityType + ")!",
+		})
+		return
+	}
+	log.Printf("Sending %s risk metrics to front-end...", equityType)
+	ctx.JSON(200, gin.H{
+		"risk":     risk,
+		"equities": equityRisk,
+	})
+}
+
+// Create the configured benchmarks in name order, or the default (SPY) if none are configured.
+func (c *PortfolioController) loadBenchmarks(benchmarkWeights map[string]map[string]float64) {
+	if len(benchmarkWeights) == 0 {
+		benchmarkWeights = finance.DefaultBenchmarks
+	}
+	names := make([]string, 0, len(benchmarkWeights))
+	for name := range benchmarkWeights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c.benchmarks = make([]*finance.Benchmark, 0, len(names))
+	for _, name := range names {
+		benchmark, err := finance.NewBenchmark(name, benchmarkWeights[name])
+		if err != nil {
+			log.Fatalf("Unable to create benchmark %s: %v", name, err)
+		}
+		c.benchmarks = append(c.benchmarks, benchmark)
+	}
+}
+
+// Send the configured benchmarks, with their weights and quote histories.
+func (c *PortfolioController) GetBenchmarks(ctx *gin.Context) {
+	log.Printf("Sending %d benchmarks to front-end...", len(c.benchmarks))
+	ctx.JSON(200, gin.H{
+		"benchmarks": c.benchmarks,
+	})
+}
+
+// Send the contribution of each sector, industry and equity type to the given portfolio's return over a period: a
+// calendar year (year=2023), or from the close of one date to another (start=2023-03-31&end=2023-06-30). Defaults to
+// the current year to date.
+func (c *PortfolioController) GetAttribution(ctx *gin.Context, equityType string) {
+	end := time.Now().UTC()
+	start := time.Date(end.Year()-1, time.December, 31, 0, 0, 0, 0, time.UTC)
+	var err error
+	if yearStr := ctx.Query("year"); yearStr != "" {
+		var year int
+		if year, err = strconv.Atoi(yearStr); err == nil {
+			start = time.Date(year-1, time.December, 31, 0, 0, 0, 0, time.UTC)
+			if yearEnd := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC); yearEnd.Before(end) {
+				end = yearEnd
+			}
+		}
+	}
+	if startStr := ctx.Query("start"); startStr != "" && err == nil {
+		start, err = time.Parse("2006-01-02", startStr)
+	}
+	if endStr := ctx.Query("end"); endStr != "" && err == nil {
+		end, err = time.Parse("2006-01-02", endStr)
+	}
+	if err != nil || !end.After(start) {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid attribution period!",
+		})
+		return
+	}
+	var eqs []*finance.Equity
+	if equityType == "full" {
+		for _, catalogue := range c.equityCatalogues {
+			eqs = append(eqs, catalogue.GetEquityList()...)
+		}
+	} else if catalogue, ok := c.equityCatalogues[equityType]; ok {
+		eqs = catalogue.GetEquityList()
+	} else {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid equity type (" + equityType + ")!",
+		})
+		return
+	}
+	log.Printf("Sending %s performance attribution to front-end...", equityType)
+	ctx.JSON(200, gin.H{
+		"attribution": finance.CalculateAttribution(eqs, start, end),
+	})
+}
+
+// Send the return correlations and concentration of the given portfolio's current holdings, for a heatmap. The
+// lookback for correlations (days=365) and the number of largest holdings to total (top=5) are optional.
+func (c *PortfolioController) GetDiversification(ctx *gin.Context, equityType string) {
+	lookbackDays, err := strconv.Atoi(ctx.DefaultQuery("days", strconv.Itoa(finance.DefaultCorrelationLookbackDays)))
+	if err != nil || lookbackDays < 2 {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid lookback days (" + ctx.Query("days") + ")!",
+		})
+		return
+	}
+	topHoldings, err := strconv.Atoi(ctx.DefaultQuery("top", strconv.Itoa(finance.DefaultTopHoldings)))
+	if err != nil || topHoldings < 1 {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid number of top holdings (" + ctx.Query("top") + ")!",
+		})
+		return
+	}
+	var eqs []*finance.Equity
+	if equityType == "full" {
+		for _, catalogue := range c.equityCatalogues {
+			eqs = append(eqs, catalogue.GetEquityList()...)
+		}
+	} else if catalogue, ok := c.equityCatalogues[equityType]; ok {
+		eqs = catalogue.GetEquityList()
+	} else {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid equity type (" + equityType + ")!",
+		})
+		return
+	}
+	log.Printf("Sending %s diversification report to front-end...", equityType)
+	ctx.JSON(200, gin.H{
+		"diversification": finance.CalculateDiversification(eqs, lookbackDays, topHoldings, time.Now()),
+	})
+}
+
+// Send the monthly returns and rolling annualized returns of the given portfolio's holdings.
+func (c *PortfolioController) GetPeriodicReturns(ctx *gin.Context, equityType string) {
+	var returns finance.PeriodicReturns
+	if equityType == "full" {
+		returns = c.fullPeriodicReturns
+	} else if catalogue, ok := c.equityCatalogues[equityType]; ok {
+		returns = catalogue.GetPeriodicReturns()
+	} else {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid equity type (" + equityType + ")!",
+		})
+		return
+	}
+	log.Printf("Sending %s periodic returns to front-end...", equityType)
+	ctx.JSON(200, gin.H{
+		"monthly": returns.Monthly,
+		"rolling": returns.Rolling,
+	})
+}
+
+// Send the value history of the given portfolio, alongside shadow portfolios that put the same cash flows into each
+// benchmark. The flows replayed are the buys and sales of equities, or the deposits and withdrawals (flows=deposits).
+func (c *PortfolioController) GetShadowPortfolios(ctx *gin.Context, equityType string) {
+	flowSource := ctx.DefaultQuery("flows", finance.ShadowFlowsTrades)
+	if flowSource != finance.ShadowFlowsTrades && flowSource != finance.ShadowFlowsDeposits {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid cash flow source (" + flowSource + ")!",
+		})
+		return
+	}
+	var flows []finance.CashFlow
+	var history map[time.Time]float64
+	if equityType == "full" {
+		histories := make([]map[time.Time]float64, 0)
+		for _, catalogue := range c.equityCatalogues {
+			catalogueFlows, catalogueHistory := catalogue.GetShadowInputs(flowSource)
+			flows = append(flows, catalogueFlows...)
+			histories = append(histories, catalogueHistory)
+		}
+		history = finance.CombineValueHistories(histories...)
+	} else if catalogue, ok := c.equityCatalogues[equityType]; ok {
+		flows, history = catalogue.GetShadowInputs(flowSource)
+	} else {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid equity type (" + equityType + ")!",
+		})
+		return
+	}
+	log.Printf("Sending %s shadow benchmark portfolios to front-end...", equityType)
+	ctx.JSON(200, gin.H{
+		"flows":   flowSource,
+		"history": history,
+		"shadows": finance.CalculateShadowPortfolios(c.benchmarks, flows, history),
+	})
+}
+
+// Send the daily OHLCV bars of a ticker's stored price history, ordered by date: the latest bars (latest=30), the bars
+// within a date range (start=2023-01-01&end=2023-12-31, either optional), or the full history.
+func (c *PortfolioController) GetPriceHistory(ctx *gin.Context, ticker string) {
+	var quote data.Quote
+	ticker = strings.ToUpper(ticker)
+	if latestStr := ctx.Query("latest"); latestStr != "" {
+		latest, err := strconv.Atoi(latestStr)
+		if err != nil || latest < 1 {
+			ctx.JSON(400, gin.H{
+				"error": "Invalid number of latest bars (" + latestStr + ")!",
+			})
+			return
+		}
+		quote = c.store.GetLatestTickerData(ticker, latest)
+	} else if ctx.Query("start") != "" || ctx.Query("end") != "" {
+		start, startErr := time.Parse("2006-01-02", ctx.DefaultQuery("start", "1900-01-01"))
+		end, endErr := time.Parse("2006-01-02", ctx.DefaultQuery("end", time.Now().UTC().Format("2006-01-02")))
+		if startErr != nil || endErr != nil || end.Before(start) {
+			ctx.JSON(400, gin.H{
+				"error": "Invalid price history date range!",
+			})
+			return
+		}
+		quote = c.store.GetTickerDataRange(ticker, start, end.Add(24*time.Hour-time.Second))
+	} else {
+		quote = c.store.GetTickerData(ticker)
+	}
+	if len(quote.Date) == 0 {
+		ctx.JSON(404, gin.H{
+			"error": "No price history found for " + ticker + "!",
+		})
+		return
+	}
+	log.Printf("Sending %d %s price history bars to front-end...", len(quote.Date), ticker)
+	ctx.JSON(200, gin.H{
+		"prices": quote,
+	})
+}
+
+// Persist the end-of-day snapshot of a portfolio's holdings, replacing any earlier one from the same day.
+func (c *PortfolioController) saveSnapshot(catalogue *finance.EquityCatalogue) {
+	snapshot := catalogue.GetSnapshot()
+	if err := c.store.StoreSnapshot(snapshot); err != nil {
+		log.Printf("WARNING: Unable to store the %s portfolio snapshot: %v", snapshot.EquityType, err)
+	}
+}
+
+// Send the stored end-of-day snapshots of a portfolio: those within a date range (start=2023-01-01&end=2023-12-31,
+// either optional), or the latest one. Read from the store, so they're available before the portfolio is calculated.
+func (c *PortfolioController) GetSnapshots(ctx *gin.Context, equityType string) {
+	if ctx.Query("start") == "" && ctx.Query("end") == "" {
+		snapshot, err := c.store.GetLatestSnapshot(equityType)
+		if errors.Is(err, data.ErrNotFound) {
+			ctx.JSON(404, gin.H{
+				"error": "No " + equityType + " portfolio snapshots found!",
+			})
+			return
+		} else if err != nil {
+			ctx.JSON(500, gin.H{
+				"error": "Unable to read portfolio snapshots: " + err.Error(),
+			})
+			return
+		}
+		log.Printf("Sending latest %s portfolio snapshot to front-end...", equityType)
+		ctx.JSON(200, gin.H{
+			"snapshots": []data.Snapshot{snapshot},
+		})
+		return
+	}
+	start, startErr := time.Parse("2006-01-02", ctx.DefaultQuery("start", "1900-01-01"))
+	end, endErr := time.Parse("2006-01-02", ctx.DefaultQuery("end", time.Now().UTC().Format("2006-01-02")))
+	if startErr != nil || endErr != nil || end.Before(start) {
+		ctx.JSON(400, gin.H{
+			"error": "Invalid snapshot date range!",
+		})
+		return
+	}
+	snapshots, err := c.store.GetSnapshots(equityType, start, end.Add(24*time.Hour-time.Second))
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"error": "Unable to read portfolio snapshots: " + err.Error(),
+		})
+		return
+	}
+	log.Printf("Sending %d %s portfolio snapshots to front-end...", len(snapshots), equityType)
+	ctx.JSON(200, gin.H{
+		"snapshots": snapshots,
+	})
+}
+
 func (c *PortfolioController) GetSp500History(ctx *gin.Context) {
 	sp500 := c.equityCatalogues["stock"].GetSp500()
 	if len(sp500.Date) == 0 {
@@ -208,8 +906,10 @@ func (c *PortfolioController) WebSocketHandler(ctx *gin.Context) {
 		prog += 3.0
 		c.SendProgressUpdate(progressSocket, prog)
 		log.Printf("Number of %s transactions processed: %d", equityType, len(txns.Values))
+		c.populateSplitHistory(c.equityCatalogues[equityType])
 		// Calculate metrics for each stock.
 		c.equityCatalogues[equityType].Calculate()
+		c.saveSnapshot(c.equityCatalogues[equityType])
 		prog += 27.0
 		c.SendProgressUpdate(progressSocket, prog)
 	}
@@ -231,18 +931,39 @@ func (c *PortfolioController) CalculatePortfolioSummaryMetrics() {
 	// Define the first trading day of the year to reference for YTD calculations.
 	c.fullPortfolioSummary.LastUpdated = time.Now()
 	totalCashFlowYtd := 0.0
+	valueHistories := make([]map[time.Time]float64, 0)
+	cashFlows := make([]finance.CashFlow, 0)
+	investmentFlows := make([]finance.CashFlow, 0)
+	investedValue := 0.0
+	holdingsHistories := make([]map[time.Time]float64, 0)
+	holdingsFlows := make([]finance.CashFlow, 0)
 	for _, equityType := range c.equityTypes {
 		summary := c.equityCatalogues[equityType].GetPortfolioSummary()
 		c.fullPortfolioSummary.MarketValueJan1 += summary.MarketValueJan1
 		c.fullPortfolioSummary.TotalMarketValue += summary.TotalMarketValue
 		c.fullPortfolioSummary.TotalCostBasis += summary.TotalCostBasis
 		c.fullPortfolioSummary.DailyGain += summary.DailyGain
+		c.fullPortfolioSummary.TotalIncome += summary.TotalIncome
 		c.fullPortfolioSummary.TotalEquities += summary.TotalEquities
 		totalCashFlowYtd += c.equityCatalogues[equityType].CashFlowByYear[time.Now().Year()]
+		valueHistories = append(valueHistories, c.equityCatalogues[equityType].GetValueHistory())
+		cashFlows = append(cashFlows, c.equityCatalogues[equityType].GetExternalCashFlows()...)
+		flows, marketValue := c.equityCatalogues[equityType].GetInvestmentCashFlows()
+		investmentFlows = append(investmentFlows, flows...)
+		investedValue += marketValue
+		holdingsHistories = append(holdingsHistories, c.equityCatalogues[equityType].PortfolioHistory)
+		holdingsFlows = append(holdingsFlows, c.equityCatalogues[equityType].GetHoldingsCashFlows()...)
 	}
 	if c.fullPortfolioSummary.TotalCostBasis > 0.001 {
 		c.fullPortfolioSummary.PercentageGain = ((c.fullPortfolioSummary.TotalMarketValue - c.fullPortfolioSummary.TotalCostBasis) / c.fullPortfolioSummary.TotalCostBasis) * 100.0
 	}
 	c.fullPortfolioSummary.AnnualPerformance = make(map[int]float64)
 	c.fullPortfolioSummary.AnnualPerformance[time.Now().Year()] = (c.fullPortfolioSummary.TotalMarketValue/(c.fullPortfolioSummary.MarketValueJan1+totalCashFlowYtd) - 1) * 100.0
+	c.fullPortfolioSummary.TimeWeightedReturns = finance.CalculateTimeWeightedReturns(finance.CombineValueHistories(valueHistories...), cashFlows)
+	c.fullPortfolioSummary.MoneyWeightedReturn = finance.CalculateMoneyWeightedReturn(investmentFlows, investedValue, time.Now())
+	c.fullPortfolioSummary.Benchmarks = finance.CompareBenchmarks(c.benchmarks, finance.CombineValueHistories(valueHistories...),
+		c.fullPortfolioSummary.TimeWeightedReturns)
+	c.fullRiskMetrics = finance.CalculateRiskMetrics(finance.CalculateDailyReturns(finance.CombineValueHistories(holdingsHistories...), holdingsFlows),
+		c.equityCatalogues["stock"].GetSp500(), c.riskFreeRate)
+	c.fullPeriodicReturns = finance.CalculatePeriodicReturns(finance.CombineValueHistories(holdingsHistories...), holdingsFlows)
 }
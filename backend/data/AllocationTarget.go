@@ -0,0 +1,40 @@
+package data
+
+import (
+	"errors"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Supported groupings for target allocations.
+const (
+	AllocationScopeTicker     = "Ticker"
+	AllocationScopeSector     = "Sector"
+	AllocationScopeEquityType = "EquityType"
+)
+
+// Definition of the target weight (% of portfolio value, including cash) for a ticker, sector or equity type.
+type AllocationTarget struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Scope       string             `bson:"scope" json:"scope"`
+	Name        string             `bson:"name" json:"name"`
+	Weight      float64            `bson:"weight" json:"weight"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+}
+
+// Verify this target has a valid scope, a name and a weight between 0 and 100%.
+func (t *AllocationTarget) Validate() error {
+	switch t.Scope {
+	case AllocationScopeTicker, AllocationScopeSector, AllocationScopeEquityType:
+	default:
+		return errors.New("Invalid allocation target scope (" + t.Scope + ")")
+	}
+	if t.Name == "" {
+		return errors.New("Allocation target requires a name")
+	}
+	if t.Weight < 0 || t.Weight > 100 {
+		return errors.New("Allocation target for " + t.Name + " has invalid weight " + strconv.FormatFloat(t.Weight, 'f', -1, 64))
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Supported corporate action types.
+const (
+	// Forward or reverse stock split. Ratio is the number of new shares per old share (e.g. 0.5 for a 1:2 reverse split).
+	CorporateActionSplit = "Split"
+	// Ticker no longer trades on an exchange, so no market data is queried for it.
+	CorporateActionDelisting = "Delisting"
+	// Ticker changed symbol to NewTicker. Transactions under the old symbol are tracked under the new one.
+	CorporateActionRename = "Rename"
+	// Ticker was acquired or merged. Each old share converts to Ratio shares of NewTicker and/or CashPerShare in cash.
+	CorporateActionMerger = "Merger"
+	// Holders of Ticker received Ratio shares of NewTicker per share, with BasisAllocation of the basis moved to them.
+	CorporateActionSpinOff = "SpinOff"
+)
+
+// Providers may date a split on its ex-date trading day rather than its announced date, so splits this many days apart
+// with the same ratio are treated as the same split.
+const splitDateToleranceDays = 5
+
+// Definition of a corporate action affecting the holdings of a ticker.
+type CorporateAction struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Ticker      string             `bson:"ticker" json:"ticker"`
+	Type        string             `bson:"type" json:"type"`
+	Date        time.Time          `bson:"date" json:"date"`
+	Ratio       float64            `bson:"ratio,omitempty" json:"ratio,omitempty"`
+	NewTicker   string             `bson:"newTicker,omitempty" json:"newTicker,omitempty"`
+	Description string             `bson:"description,omitempty" json:"description,omitempty"`
+	// Cash paid per old share in a merger.
+	CashPerShare float64 `bson:"cashPerShare,omitempty" json:"cashPerShare,omitempty"`
+	// Fraction of the old shares' cost basis carried to the NewTicker shares, for a spin-off, or a merger paying both
+	// stock and cash.
+	BasisAllocation float64 `bson:"basisAllocation,omitempty" json:"basisAllocation,omitempty"`
+}
+
+// Verify the fields required by this corporate action's type are populated.
+func (a *CorporateAction) Validate() error {
+	if a.Ticker == "" {
+		return errors.New("Corporate action requires a ticker")
+	}
+	switch a.Type {
+	case CorporateActionSplit:
+		if a.Date.IsZero() || a.Ratio <= 0 {
+			return errors.New("Split for " + a.Ticker + " requires a date and a positive ratio")
+		}
+	case CorporateActionDelisting:
+	case CorporateActionRename:
+		if a.Date.IsZero() || a.NewTicker == "" {
+			return errors.New("Rename of " + a.Ticker + " requires a date and a new ticker")
+		}
+	case CorporateActionMerger:
+		if a.Date.IsZero() || (a.NewTicker == "" && a.CashPerShare <= 0) {
+			return errors.New("Merger of " + a.Ticker + " requires a date, and a new ticker and/or cash per share")
+		}
+		if a.NewTicker != "" && a.Ratio <= 0 {
+			return errors.New("Merger of " + a.Ticker + " into " + a.NewTicker + " requires a positive ratio")
+		}
+		if a.NewTicker != "" && a.CashPerShare > 0 && (a.BasisAllocation <= 0 || a.BasisAllocation > 1) {
+			return errors.New("Merger of " + a.Ticker + " for stock and cash requires a basis allocation between 0 and 1")
+		}
+	case CorporateActionSpinOff:
+		if a.Date.IsZero() || a.NewTicker == "" || a.Ratio <= 0 {
+			return errors.New("Spin-off from " + a.Ticker + " requires a date, a new ticker and a positive ratio")
+		}
+		if a.BasisAllocation <= 0 || a.BasisAllocation >= 1 {
+			return errors.New("Spin-off from " + a.Ticker + " requires a basis allocation between 0 and 1")
+		}
+	default:
+		return errors.New("Invalid corporate action type (" + a.Type + ") for " + a.Ticker)
+	}
+	return nil
+}
+
+// Check whether this corporate action records the same event as the given one. Splits match on ratio and a date within
+// a few days, other actions on the exact date.
+func (a *CorporateAction) Duplicates(other CorporateAction) bool {
+	if a.Ticker != other.Ticker || a.Type != other.Type {
+		return false
+	}
+	if a.Type != CorporateActionSplit {
+		return a.Date.Equal(other.Date)
+	}
+	gap := a.Date.Sub(other.Date)
+	if gap < 0 {
+		gap = -gap
+	}
+	return a.Ratio == other.Ratio && gap <= splitDateToleranceDays*24*time.Hour
+}
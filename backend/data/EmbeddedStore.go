@@ -0,0 +1,362 @@
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Names of the top-level buckets in the embedded store. Price history has a nested bucket per ticker, and snapshots
+// a nested bucket per equity type.
+var (
+	priceHistoryBucket      = []byte("priceHistory")
+	corporateActionsBucket  = []byte("corporateActions")
+	allocationTargetsBucket = []byte("allocationTargets")
+	snapshotsBucket         = []byte("snapshots")
+)
+
+// Define a store kept in a single local file, for running without a database server.
+type EmbeddedStore struct {
+	db *bolt.DB
+}
+
+// Define the record stored for each date of a ticker's price history.
+type embeddedQuote struct {
+	Price  float64 `json:"price"`
+	Open   float64 `json:"open,omitempty"`
+	High   float64 `json:"high,omitempty"`
+	Low    float64 `json:"low,omitempty"`
+	Volume float64 `json:"volume,omitempty"`
+}
+
+// Constructor for a new EmbeddedStore, creating the file if it doesn't exist yet.
+func NewEmbeddedStore(path string) (*EmbeddedStore, error) {
+	var es EmbeddedStore
+	var err error
+	if es.db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second}); err != nil {
+		return nil, err
+	}
+	err = es.db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{priceHistoryBucket, corporateActionsBucket, allocationTargetsBucket, snapshotsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		es.db.Close()
+		return nil, err
+	}
+	return &es, nil
+}
+
+// Close the store's file.
+func (es *EmbeddedStore) Close() error {
+	return es.db.Close()
+}
+
+// Helper function to encode a date as a key that sorts chronologically.
+func dateKey(date time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(date.Unix()))
+	return key
+}
+
+// Helper function to decode a date key.
+func keyDate(key []byte) time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint64(key)), 0).UTC()
+}
+
+func (es *EmbeddedStore) TickerExists(ticker string) bool {
+	exists := false
+	es.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(priceHistoryBucket).Bucket([]byte(ticker)); bucket != nil {
+			key, _ := bucket.Cursor().First()
+			exists = key != nil
+		}
+		return nil
+	})
+	return exists
+}
+
+func (es *EmbeddedStore) GetLatestQuote(ticker string) time.Time {
+	var latest time.Time
+	es.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(priceHistoryBucket).Bucket([]byte(ticker)); bucket != nil {
+			if key, _ := bucket.Cursor().Last(); key != nil {
+				latest = keyDate(key)
+			}
+		}
+		return nil
+	})
+	return latest
+}
+
+// Get the date of the most recent quote stored for every ticker.
+func (es *EmbeddedStore) GetLatestQuoteDates() map[string]time.Time {
+	latest := make(map[string]time.Time)
+	es.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(priceHistoryBucket).ForEach(func(ticker, _ []byte) error {
+			if bucket := tx.Bucket(priceHistoryBucket).Bucket(ticker); bucket != nil {
+				if key, _ := bucket.Cursor().Last(); key != nil {
+					latest[string(ticker)] = keyDate(key)
+				}
+			}
+			return nil
+		})
+	})
+	return latest
+}
+
+func (es *EmbeddedStore) GetTickerData(ticker string) Quote {
+	return es.GetTickerDataRange(ticker, time.Unix(0, 0), time.Now().AddDate(1, 0, 0))
+}
+
+func (es *EmbeddedStore) GetTickerDataRange(ticker string, start time.Time, end time.Time) Quote {
+	var data Quote
+	data.Symbol = ticker
+	es.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(priceHistoryBucket).Bucket([]byte(ticker))
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		endKey := dateKey(end)
+		for key, value := cursor.Seek(dateKey(start)); key != nil && bytes.Compare(key, endKey) <= 0; key, value = cursor.Next() {
+			es.appendBar(&data, key, value)
+		}
+		return nil
+	})
+	return data
+}
+
+func (es *EmbeddedStore) GetLatestTickerData(ticker string, count int) Quote {
+	var data Quote
+	data.Symbol = ticker
+	es.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(priceHistoryBucket).Bucket([]byte(ticker))
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		for key, value := cursor.Last(); key != nil && len(data.Date) < count; key, value = cursor.Prev() {
+			es.appendBar(&data, key, value)
+		}
+		return nil
+	})
+	data.SortByDate()
+	return data
+}
+
+// Helper function to decode a stored record and append its bar to the quote.
+func (es *EmbeddedStore) appendBar(data *Quote, key []byte, value []byte) {
+	var q embeddedQuote
+	if err := json.Unmarshal(value, &q); err != nil {
+		log.Printf("WARNING: Failed to decode the %s record for %v: %v", data.Symbol, keyDate(key), err)
+		return
+	}
+	data.AppendBar(Bar{Date: keyDate(key), Open: q.Open, High: q.High, Low: q.Low, Close: q.Price, Volume: q.Volume})
+}
+
+func (es *EmbeddedStore) StoreTickerData(q Quote) {
+	err := es.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(priceHistoryBucket).CreateBucketIfNotExists([]byte(q.Symbol))
+		if err != nil {
+			return err
+		}
+		for i := range q.Close {
+			bar := q.Bar(i)
+			value, err := json.Marshal(embeddedQuote{Price: bar.Close, Open: bar.Open, High: bar.High, Low: bar.Low, Volume: bar.Volume})
+			if err != nil {
+				return err
+			}
+			if err = bucket.Put(dateKey(bar.Date), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("WARNING: Unable to store %s price history: %v", q.Symbol, err)
+	}
+}
+
+// Helper function to read every record in a bucket, keyed by ID, decoding each with the given function.
+func (es *EmbeddedStore) readAll(bucketName []byte, decode func(value []byte) error) error {
+	return es.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).ForEach(func(_, value []byte) error {
+			return decode(value)
+		})
+	})
+}
+
+// Helper function to write a record to a bucket, keyed by ID. Unless inserting, the record must already exist.
+func (es *EmbeddedStore) put(bucketName []byte, id primitive.ObjectID, record interface{}, insert bool) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return es.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		if !insert && bucket.Get([]byte(id.Hex())) == nil {
+			return ErrNotFound
+		}
+		return bucket.Put([]byte(id.Hex()), value)
+	})
+}
+
+// Helper function to delete the record with the given ID from a bucket.
+func (es *EmbeddedStore) delete(bucketName []byte, id primitive.ObjectID) error {
+	return es.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		if bucket.Get([]byte(id.Hex())) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(id.Hex()))
+	})
+}
+
+// Get all corporate actions in the store, ordered by date.
+func (es *EmbeddedStore) GetCorporateActions() ([]CorporateAction, error) {
+	actions := make([]CorporateAction, 0)
+	err := es.readAll(corporateActionsBucket, func(value []byte) error {
+		var action CorporateAction
+		if err := json.Unmarshal(value, &action); err != nil {
+			return err
+		}
+		actions = append(actions, action)
+		return nil
+	})
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].Date.Before(actions[j].Date)
+	})
+	return actions, err
+}
+
+// Insert a new corporate action into the store, saving its generated ID.
+func (es *EmbeddedStore) InsertCorporateAction(action *CorporateAction) error {
+	action.ID = primitive.NewObjectID()
+	return es.put(corporateActionsBucket, action.ID, action, true)
+}
+
+// Insert a corporate action, unless it duplicates one already stored for the ticker.
+// Returns whether the action was inserted.
+func (es *EmbeddedStore) InsertCorporateActionIfMissing(action *CorporateAction) (bool, error) {
+	actions, err := es.GetCorporateActions()
+	if err != nil {
+		return false, err
+	}
+	for _, existing := range actions {
+		if action.Duplicates(existing) {
+			return false, nil
+		}
+	}
+	return true, es.InsertCorporateAction(action)
+}
+
+// Replace the corporate action with the matching ID.
+func (es *EmbeddedStore) UpdateCorporateAction(action CorporateAction) error {
+	return es.put(corporateActionsBucket, action.ID, action, false)
+}
+
+// Delete the corporate action with the given ID.
+func (es *EmbeddedStore) DeleteCorporateAction(id primitive.ObjectID) error {
+	return es.delete(corporateActionsBucket, id)
+}
+
+// Get all allocation targets in the store, ordered by scope and name.
+func (es *EmbeddedStore) GetAllocationTargets() ([]AllocationTarget, error) {
+	targets := make([]AllocationTarget, 0)
+	err := es.readAll(allocationTargetsBucket, func(value []byte) error {
+		var target AllocationTarget
+		if err := json.Unmarshal(value, &target); err != nil {
+			return err
+		}
+		targets = append(targets, target)
+		return nil
+	})
+	sort.SliceStable(targets, func(i, j int) bool {
+		if targets[i].Scope != targets[j].Scope {
+			return targets[i].Scope < targets[j].Scope
+		}
+		return targets[i].Name < targets[j].Name
+	})
+	return targets, err
+}
+
+// Insert a new allocation target into the store, saving its generated ID.
+func (es *EmbeddedStore) InsertAllocationTarget(target *AllocationTarget) error {
+	target.ID = primitive.NewObjectID()
+	return es.put(allocationTargetsBucket, target.ID, target, true)
+}
+
+// Replace the allocation target with the matching ID.
+func (es *EmbeddedStore) UpdateAllocationTarget(target AllocationTarget) error {
+	return es.put(allocationTargetsBucket, target.ID, target, false)
+}
+
+// Delete the allocation target with the given ID.
+func (es *EmbeddedStore) DeleteAllocationTarget(id primitive.ObjectID) error {
+	return es.delete(allocationTargetsBucket, id)
+}
+
+// Store a snapshot, replacing any existing one for the same equity type and date.
+func (es *EmbeddedStore) StoreSnapshot(snapshot Snapshot) error {
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return es.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(snapshotsBucket).CreateBucketIfNotExists([]byte(snapshot.EquityType))
+		if err != nil {
+			return err
+		}
+		return bucket.Put(dateKey(snapshot.Date), value)
+	})
+}
+
+// Get the snapshots of an equity type between the start and end dates (inclusive), ordered by date.
+func (es *EmbeddedStore) GetSnapshots(equityType string, start time.Time, end time.Time) ([]Snapshot, error) {
+	snapshots := make([]Snapshot, 0)
+	err := es.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(snapshotsBucket).Bucket([]byte(equityType))
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		endKey := dateKey(end)
+		for key, value := cursor.Seek(dateKey(start)); key != nil && bytes.Compare(key, endKey) <= 0; key, value = cursor.Next() {
+			var snapshot Snapshot
+			if err := json.Unmarshal(value, &snapshot); err != nil {
+				return err
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+		return nil
+	})
+	return snapshots, err
+}
+
+// Get the most recent snapshot of an equity type, or ErrNotFound if there are none.
+func (es *EmbeddedStore) GetLatestSnapshot(equityType string) (Snapshot, error) {
+	var snapshot Snapshot
+	err := es.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(snapshotsBucket).Bucket([]byte(equityType))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		key, value := bucket.Cursor().Last()
+		if key == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(value, &snapshot)
+	})
+	return snapshot, err
+}
@@ -2,15 +2,38 @@ package data
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/exp/maps"
 )
 
+// Name of the collection housing corporate actions (splits, delistings, renames).
+const corporateActionsCollection = "corporateActions"
+
+// Name of the collection housing target allocations for rebalancing.
+const allocationTargetsCollection = "allocationTargets"
+
+// Name of the collection housing the end-of-day portfolio snapshots of each equity type.
+const snapshotsCollection = "snapshots"
+
+// Name of the unique (equity type, date) index on the snapshots collection.
+const snapshotIndexName = "equitytype_date_unique"
+
+// Name of the collection housing the daily price history of every ticker. A regular collection rather than a
+// time-series one, which can't hold the unique (ticker, date) index that keeps each date from being stored twice.
+const priceHistoryCollection = "priceHistory"
+
+// Name of the unique (ticker, date) index on the price history collection.
+const priceIndexName = "ticker_date_unique"
+
 // Define our MongoDB client.
 type MongoDbClient struct {
 	databaseName string
@@ -26,6 +49,10 @@ type TempQuote struct {
 	Ticker   string             `bson:"ticker,omitempty"`
 	DateTime time.Time          `bson:"DateTime,omitempty"`
 	Price    float64            `bson:"price,omitempty"`
+	Open     float64            `bson:"open,omitempty"`
+	High     float64            `bson:"high,omitempty"`
+	Low      float64            `bson:"low,omitempty"`
+	Volume   float64            `bson:"volume,omitempty"`
 }
 
 // Constructor for a new MongoDbClient object.
@@ -35,7 +62,7 @@ func NewMongoDbClient() *MongoDbClient {
 }
 
 // Connect to our MongoDB and grab the Polly data collection.
-func (mc *MongoDbClient) ConnectMongoDb(connectionUri string, dbName string) {
+func (mc *MongoDbClient) ConnectMongoDb(connectionUri string, dbName string) error {
 	mc.databaseName = dbName
 	// Set connection URL.
 	clientOptions := options.Client().ApplyURI(connectionUri)
@@ -45,87 +72,422 @@ func (mc *MongoDbClient) ConnectMongoDb(connectionUri string, dbName string) {
 	// Connect to MongoDB.
 	client, err := mongo.Connect(mc.ctx, clientOptions)
 	if err != nil {
-		log.Fatalf("Unable to connect to the MongoDB instance: %v", err)
+		return fmt.Errorf("Unable to connect to the MongoDB instance: %w", err)
 	}
 	mc.mongoClient = client
 	// Check the connection.
 	err = mc.mongoClient.Ping(mc.ctx, nil)
 	if err != nil {
-		log.Fatalf("Unable to ping MongoDB instance: %v", err)
+		return fmt.Errorf("Unable to ping MongoDB instance: %w", err)
 	}
 	// Connect to the database.
 	mc.pollyDb = mc.mongoClient.Database(mc.databaseName)
+	mc.stockHistory = mc.pollyDb.Collection(priceHistoryCollection)
+	return nil
 }
 
 func (mc *MongoDbClient) TickerExists(ticker string) bool {
-	// Get the complete list of collections in the database.
-	names, err := mc.pollyDb.ListCollectionNames(mc.ctx, bson.M{"type": "collection"})
+	count, err := mc.stockHistory.CountDocuments(mc.ctx, bson.M{"ticker": ticker}, options.Count().SetLimit(1))
 	if err != nil {
-		log.Printf("ERROR: Failed to get MongoDB collection names: %v", err)
+		log.Printf("ERROR: Failed to count %s price history: %v", ticker, err)
 		return false
 	}
-	// Look for the collection matching the given ticker.
-	for _, name := range names {
-		if name == ticker {
-			return true
-		}
-	}
-	return false
+	return count > 0
 }
 
+// Get the date of the most recent quote stored for a ticker, or the zero time if there are none.
 func (mc *MongoDbClient) GetLatestQuote(ticker string) time.Time {
 	// Setup the filter and sorting options.
 	filter := bson.M{"ticker": ticker}
-	options := options.FindOne().SetSort(bson.D{{"DateTime", -1}})
+	options := options.FindOne().SetSort(bson.D{{Key: "DateTime", Value: -1}})
 
 	// Lookup the most recent document in the DB for this ticker.
-	var result bson.M
-	err := mc.pollyDb.Collection(ticker).FindOne(mc.ctx, filter, options).Decode(&result)
+	var result TempQuote
+	if err := mc.stockHistory.FindOne(mc.ctx, filter, options).Decode(&result); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("WARNING: Failed to find the latest %s quote: %v", ticker, err)
+		}
+		return time.Time{}
+	}
+	return result.DateTime
+}
+
+// Get the date of the most recent quote stored for every ticker, in one query.
+func (mc *MongoDbClient) GetLatestQuoteDates() map[string]time.Time {
+	latest := make(map[string]time.Time)
+	pipeline := mongo.Pipeline{{{Key: "$group", Value: bson.M{"_id": "$ticker", "latest": bson.M{"$max": "$DateTime"}}}}}
+	cursor, err := mc.stockHistory.Aggregate(mc.ctx, pipeline)
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("WARNING: Failed to find the latest quotes: %v", err)
+		return latest
+	}
+	var results []struct {
+		Ticker string    `bson:"_id"`
+		Latest time.Time `bson:"latest"`
 	}
-	// Get the datetime of the most recent document.
-	dateTime, ok := result["DateTime"].(primitive.DateTime)
-	if !ok {
-		log.Fatal("DateTime field from MongoDB data is not the expected type (primitive.DateTime).")
+	if err = cursor.All(mc.ctx, &results); err != nil {
+		log.Printf("WARNING: Failed to decode the latest quotes: %v", err)
+		return latest
 	}
-	return dateTime.Time()
+	for _, result := range results {
+		latest[result.Ticker] = result.Latest
+	}
+	return latest
 }
 
+// Get the full price history of a ticker, ordered by date.
 func (mc *MongoDbClient) GetTickerData(ticker string) Quote {
+	return mc.findQuotes(ticker, bson.M{"ticker": ticker}, options.Find().SetSort(bson.D{{Key: "DateTime", Value: 1}}))
+}
+
+func (mc *MongoDbClient) GetTickerDataRange(ticker string, start time.Time, end time.Time) Quote {
+	filter := bson.M{"ticker": ticker, "DateTime": bson.M{"$gte": start, "$lte": end}}
+	return mc.findQuotes(ticker, filter, options.Find().SetSort(bson.D{{Key: "DateTime", Value: 1}}))
+}
+
+func (mc *MongoDbClient) GetLatestTickerData(ticker string, count int) Quote {
+	options := options.Find().SetSort(bson.D{{Key: "DateTime", Value: -1}}).SetLimit(int64(count))
+	data := mc.findQuotes(ticker, bson.M{"ticker": ticker}, options)
+	data.SortByDate()
+	return data
+}
+
+// Helper function to query the bars of a ticker's price history matching the filter.
+func (mc *MongoDbClient) findQuotes(ticker string, filter bson.M, options *options.FindOptions) Quote {
 	var data Quote
 	data.Symbol = ticker
-	// Grab the corresponding stock history collection from the DB.
-	cursor, err := mc.pollyDb.Collection(ticker).Find(mc.ctx, bson.M{})
+	cursor, err := mc.stockHistory.Find(mc.ctx, filter, options)
 	if err != nil {
-		log.Fatalf("GetTickerData: Failed to find collection for ticker %s: %v", ticker, err)
+		log.Printf("WARNING: Failed to find price history for ticker %s: %v", ticker, err)
+		return data
 	}
 	defer cursor.Close(mc.ctx)
 
 	// Iterate through the records, saving each.
 	for cursor.Next(mc.ctx) {
 		var q TempQuote
-		err := cursor.Decode(&q)
-		if err != nil {
-			log.Fatalf("GetTickerData: Failed to decode the record: %v: %v", q, err)
+		if err := cursor.Decode(&q); err != nil {
+			log.Printf("WARNING: Failed to decode the %s record: %v: %v", ticker, q, err)
+			continue
 		}
-		data.Date = append(data.Date, q.DateTime)
-		data.Close = append(data.Close, q.Price)
+		data.AppendBar(Bar{Date: q.DateTime, Open: q.Open, High: q.High, Low: q.Low, Close: q.Price, Volume: q.Volume})
 	}
 	return data
 }
 
+// Upsert the price history into the price history collection in one bulk write, so overlapping fetches don't store a
+// date twice.
 func (mc *MongoDbClient) StoreTickerData(q Quote) {
-	// Grab the corresponding stock history collection from the DB.
-	historyData := mc.pollyDb.Collection(q.Symbol)
-	// Insert the stock price data into the collection.
-	for i, _ := range q.Close {
-		_, err := historyData.InsertOne(mc.ctx,
-			bson.M{"ticker": q.Symbol, "DateTime": q.Date[i], "price": q.Close[i]})
+	if err := mc.upsertQuotes(mc.stockHistory, q); err != nil {
+		log.Printf("WARNING: Unable to store %s price history: %v", q.Symbol, err)
+	}
+}
+
+// Helper function to upsert the bars of a quote into a collection, keyed by ticker and date.
+func (mc *MongoDbClient) upsertQuotes(collection *mongo.Collection, q Quote) error {
+	if len(q.Close) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(q.Close))
+	for i := range q.Close {
+		bar := q.Bar(i)
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"ticker": q.Symbol, "DateTime": bar.Date}).
+			SetUpdate(bson.M{"$set": bson.M{"price": bar.Close, "open": bar.Open, "high": bar.High, "low": bar.Low, "volume": bar.Volume}}).
+			SetUpsert(true))
+	}
+	_, err := collection.BulkWrite(mc.ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// Create the unique (ticker, date) index on the price history collection, if it doesn't exist yet. If the collection
+// already holds duplicate dates, it's left unindexed until de-duplicated.
+func (mc *MongoDbClient) EnsurePriceIndex() {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "ticker", Value: 1}, {Key: "DateTime", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName(priceIndexName),
+	}
+	if _, err := mc.stockHistory.Indexes().CreateOne(mc.ctx, index); err != nil {
+		log.Printf("WARNING: Unable to create unique price index (run with -dedupe to remove duplicates): %v", err)
+	}
+}
+
+// Move the price history from the earlier layout of one collection per ticker into the price history collection,
+// dropping each ticker's collection once copied. Only collections whose every document belongs to the ticker the
+// collection is named for are migrated. Returns the number of tickers migrated.
+func (mc *MongoDbClient) MigratePriceHistory() (int, error) {
+	names, err := mc.pollyDb.ListCollectionNames(mc.ctx, bson.M{"type": "collection"})
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, ticker := range names {
+		switch ticker {
+		case priceHistoryCollection, corporateActionsCollection, allocationTargetsCollection, snapshotsCollection:
+			continue
+		}
+		if strings.HasPrefix(ticker, "system.") {
+			continue
+		}
+		// Carry on with the other tickers if one fails, it's retried on the next startup.
+		if ok, err := mc.migrateTickerCollection(ticker); err != nil {
+			log.Printf("WARNING: Unable to migrate the %s collection to the %s collection: %v", ticker, priceHistoryCollection, err)
+		} else if ok {
+			migrated++
+		}
+	}
+	return migrated, nil
+}
+
+// Copy a legacy ticker collection into the price history collection, then drop it once every date is verified as
+// copied. Returns whether the collection held the ticker's price history (and so was migrated).
+func (mc *MongoDbClient) migrateTickerCollection(ticker string) (bool, error) {
+	legacy := mc.pollyDb.Collection(ticker)
+	// Leave alone any collection that's empty, or holds documents not belonging to the ticker.
+	if count, err := legacy.CountDocuments(mc.ctx, bson.M{}, options.Count().SetLimit(1)); err != nil || count == 0 {
+		return false, err
+	}
+	if count, err := legacy.CountDocuments(mc.ctx, bson.M{"ticker": bson.M{"$ne": ticker}}, options.Count().SetLimit(1)); err != nil || count > 0 {
+		return false, err
+	}
+	// Order by ID (i.e. insertion time), so the first quote stored for each date is read first.
+	cursor, err := legacy.Find(mc.ctx, bson.M{"ticker": ticker}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return false, err
+	}
+	var records []TempQuote
+	if err = cursor.All(mc.ctx, &records); err != nil {
+		return false, err
+	}
+	quote := Quote{Symbol: ticker}
+	// The legacy collection may hold duplicate dates, of which only the first stored is kept, like RemoveDuplicateQuotes.
+	dates := make(map[time.Time]bool)
+	for _, q := range records {
+		if dates[q.DateTime] {
+			continue
+		}
+		quote.AppendBar(Bar{Date: q.DateTime, Open: q.Open, High: q.High, Low: q.Low, Close: q.Price, Volume: q.Volume})
+		dates[q.DateTime] = true
+	}
+	if err = mc.upsertQuotes(mc.stockHistory, quote); err != nil {
+		return false, err
+	}
+	copied, err := mc.stockHistory.CountDocuments(mc.ctx, bson.M{"ticker": ticker, "DateTime": bson.M{"$in": maps.Keys(dates)}})
+	if err != nil {
+		return false, err
+	}
+	if int(copied) < len(dates) {
+		return false, fmt.Errorf("only %d of %d dates copied", copied, len(dates))
+	}
+	if err = legacy.Drop(mc.ctx); err != nil {
+		return false, err
+	}
+	log.Printf("Migrated %d %s quotes to the %s collection", len(records), ticker, priceHistoryCollection)
+	return true, nil
+}
+
+// Remove all but the first quote stored for each ticker and date in the price history collection, then index it.
+// Returns the number of quotes removed.
+func (mc *MongoDbClient) RemoveDuplicateQuotes() (int, error) {
+	pipeline := mongo.Pipeline{
+		// Order by ID (i.e. insertion time), so each group lists the first quote stored first.
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"ticker": "$ticker", "DateTime": "$DateTime"},
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+	cursor, err := mc.stockHistory.Aggregate(mc.ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	var groups []struct {
+		Ids []primitive.ObjectID `bson:"ids"`
+	}
+	if err = cursor.All(mc.ctx, &groups); err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, group := range groups {
+		// Keep the first quote stored for this date.
+		result, err := mc.stockHistory.DeleteMany(mc.ctx, bson.M{"_id": bson.M{"$in": group.Ids[1:]}})
 		if err != nil {
-			log.Fatal(err)
+			return removed, err
+		}
+		removed += int(result.DeletedCount)
+	}
+	mc.EnsurePriceIndex()
+	return removed, nil
+}
+
+// Get all corporate actions in the DB, ordered by date.
+func (mc *MongoDbClient) GetCorporateActions() ([]CorporateAction, error) {
+	options := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+	cursor, err := mc.pollyDb.Collection(corporateActionsCollection).Find(mc.ctx, bson.M{}, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(mc.ctx)
+	actions := make([]CorporateAction, 0)
+	if err = cursor.All(mc.ctx, &actions); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+// Insert a new corporate action into the DB, saving its generated ID.
+func (mc *MongoDbClient) InsertCorporateAction(action *CorporateAction) error {
+	action.ID = primitive.NilObjectID
+	result, err := mc.pollyDb.Collection(corporateActionsCollection).InsertOne(mc.ctx, action)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		action.ID = id
+	}
+	return nil
+}
+
+// Insert a corporate action, unless it duplicates one already stored for the ticker.
+// Returns whether the action was inserted.
+func (mc *MongoDbClient) InsertCorporateActionIfMissing(action *CorporateAction) (bool, error) {
+	cursor, err := mc.pollyDb.Collection(corporateActionsCollection).Find(mc.ctx,
+		bson.M{"ticker": action.Ticker, "type": action.Type})
+	if err != nil {
+		return false, err
+	}
+	var existing []CorporateAction
+	if err = cursor.All(mc.ctx, &existing); err != nil {
+		return false, err
+	}
+	for _, other := range existing {
+		if action.Duplicates(other) {
+			return false, nil
 		}
 	}
+	return true, mc.InsertCorporateAction(action)
+}
+
+// Replace the corporate action with the matching ID.
+func (mc *MongoDbClient) UpdateCorporateAction(action CorporateAction) error {
+	result, err := mc.pollyDb.Collection(corporateActionsCollection).ReplaceOne(mc.ctx, bson.M{"_id": action.ID}, action)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete the corporate action with the given ID.
+func (mc *MongoDbClient) DeleteCorporateAction(id primitive.ObjectID) error {
+	result, err := mc.pollyDb.Collection(corporateActionsCollection).DeleteOne(mc.ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Get all allocation targets in the DB, ordered by scope and name.
+func (mc *MongoDbClient) GetAllocationTargets() ([]AllocationTarget, error) {
+	options := options.Find().SetSort(bson.D{{Key: "scope", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := mc.pollyDb.Collection(allocationTargetsCollection).Find(mc.ctx, bson.M{}, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(mc.ctx)
+	targets := make([]AllocationTarget, 0)
+	if err = cursor.All(mc.ctx, &targets); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+// Insert a new allocation target into the DB, saving its generated ID.
+func (mc *MongoDbClient) InsertAllocationTarget(target *AllocationTarget) error {
+	target.ID = primitive.NilObjectID
+	result, err := mc.pollyDb.Collection(allocationTargetsCollection).InsertOne(mc.ctx, target)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		target.ID = id
+	}
+	return nil
+}
+
+// Replace the allocation target with the matching ID.
+func (mc *MongoDbClient) UpdateAllocationTarget(target AllocationTarget) error {
+	result, err := mc.pollyDb.Collection(allocationTargetsCollection).ReplaceOne(mc.ctx, bson.M{"_id": target.ID}, target)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete the allocation target with the given ID.
+func (mc *MongoDbClient) DeleteAllocationTarget(id primitive.ObjectID) error {
+	result, err := mc.pollyDb.Collection(allocationTargetsCollection).DeleteOne(mc.ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Create the unique (equity type, date) index on the snapshots collection, if it doesn't exist yet.
+func (mc *MongoDbClient) EnsureSnapshotIndex() {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "equityType", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName(snapshotIndexName),
+	}
+	if _, err := mc.pollyDb.Collection(snapshotsCollection).Indexes().CreateOne(mc.ctx, index); err != nil {
+		log.Printf("WARNING: Unable to create unique snapshot index: %v", err)
+	}
+}
+
+// Store a snapshot, replacing any existing one for the same equity type and date.
+func (mc *MongoDbClient) StoreSnapshot(snapshot Snapshot) error {
+	_, err := mc.pollyDb.Collection(snapshotsCollection).ReplaceOne(mc.ctx,
+		bson.M{"equityType": snapshot.EquityType, "date": snapshot.Date}, snapshot, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Get the snapshots of an equity type between the start and end dates (inclusive), ordered by date.
+func (mc *MongoDbClient) GetSnapshots(equityType string, start time.Time, end time.Time) ([]Snapshot, error) {
+	filter := bson.M{"equityType": equityType, "date": bson.M{"$gte": start, "$lte": end}}
+	options := options.Find().SetSort(bson.D{{Key: "date", Value: 1}})
+	cursor, err := mc.pollyDb.Collection(snapshotsCollection).Find(mc.ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(mc.ctx)
+	snapshots := make([]Snapshot, 0)
+	if err = cursor.All(mc.ctx, &snapshots); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// Get the most recent snapshot of an equity type, or ErrNotFound if there are none.
+func (mc *MongoDbClient) GetLatestSnapshot(equityType string) (Snapshot, error) {
+	var snapshot Snapshot
+	options := options.FindOne().SetSort(bson.D{{Key: "date", Value: -1}})
+	err := mc.pollyDb.Collection(snapshotsCollection).FindOne(mc.ctx, bson.M{"equityType": equityType}, options).Decode(&snapshot)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return snapshot, ErrNotFound
+	}
+	return snapshot, err
 }
 
 func (mc *MongoDbClient) DisconnectMongoDb() {
@@ -1,6 +1,9 @@
 package data
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 // Quote - stucture for historical price data
 type Quote struct {
@@ -13,3 +16,61 @@ type Quote struct {
 	Close     []float64   `json:"close"`
 	Volume    []float64   `json:"volume"`
 }
+
+// Definition of the prices and volume of one day of a quote's history.
+type Bar struct {
+	Date   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+// Get the bar at the given index. Optional bar arrays that are not fully populated are read as zero.
+func (q *Quote) Bar(i int) Bar {
+	valueAt := func(arr []float64) float64 {
+		if len(arr) == len(q.Close) && i < len(arr) {
+			return arr[i]
+		}
+		return 0.0
+	}
+	return Bar{Date: q.Date[i], Open: valueAt(q.Open), High: valueAt(q.High), Low: valueAt(q.Low), Close: q.Close[i],
+		Volume: valueAt(q.Volume)}
+}
+
+// Append a bar to the end of this quote's history.
+func (q *Quote) AppendBar(b Bar) {
+	q.Date = append(q.Date, b.Date)
+	q.Open = append(q.Open, b.Open)
+	q.High = append(q.High, b.High)
+	q.Low = append(q.Low, b.Low)
+	q.Close = append(q.Close, b.Close)
+	q.Volume = append(q.Volume, b.Volume)
+}
+
+// Sort the bars in this quote by ascending date. Optional bar arrays that are not fully populated are left as-is.
+func (q *Quote) SortByDate() {
+	order := make([]int, len(q.Date))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return q.Date[order[i]].Before(q.Date[order[j]])
+	})
+	dates := make([]time.Time, len(q.Date))
+	for i, idx := range order {
+		dates[i] = q.Date[idx]
+	}
+	q.Date = dates
+	for _, arr := range []*[]float64{&q.Open, &q.High, &q.Low, &q.Close, &q.Volume} {
+		if len(*arr) != len(order) {
+			continue
+		}
+		sorted := make([]float64, len(order))
+		for i, idx := range order {
+			sorted[i] = (*arr)[idx]
+		}
+		*arr = sorted
+	}
+}
@@ -0,0 +1,24 @@
+package data
+
+import (
+	"time"
+)
+
+// Definition of a position held at the end of a snapshot's day.
+type SnapshotHolding struct {
+	Ticker      string  `bson:"ticker" json:"ticker"`
+	Shares      float64 `bson:"shares" json:"shares"`
+	Price       float64 `bson:"price" json:"price"`
+	MarketValue float64 `bson:"marketValue" json:"marketValue"`
+	CostBasis   float64 `bson:"costBasis" json:"costBasis"`
+}
+
+// Definition of the end-of-day state of the portfolio of one equity type. The market value includes the cash balance.
+type Snapshot struct {
+	EquityType  string            `bson:"equityType" json:"equityType"`
+	Date        time.Time         `bson:"date" json:"date"`
+	MarketValue float64           `bson:"marketValue" json:"marketValue"`
+	Cash        float64           `bson:"cash" json:"cash"`
+	CostBasis   float64           `bson:"costBasis" json:"costBasis"`
+	Holdings    []SnapshotHolding `bson:"holdings" json:"holdings"`
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/kfwalther/Polly/backend/config"
+)
+
+// Returned when updating or deleting a record that isn't in the store.
+var ErrNotFound = errors.New("No matching record found in the store")
+
+// Interface for storing and querying the daily price history (OHLCV bars) of each ticker.
+type PriceStore interface {
+	TickerExists(ticker string) bool
+	GetLatestQuote(ticker string) time.Time
+	// Get the date of the most recent quote stored for every ticker.
+	GetLatestQuoteDates() map[string]time.Time
+	GetTickerData(ticker string) Quote
+	// Get the price history of a ticker between the start and end dates (inclusive), ordered by date.
+	GetTickerDataRange(ticker string, start time.Time, end time.Time) Quote
+	// Get the latest bars (up to the count) of a ticker's price history, ordered by date.
+	GetLatestTickerData(ticker string, count int) Quote
+	StoreTickerData(q Quote)
+}
+
+// Interface for storing the corporate actions (splits, delistings, renames, mergers, spin-offs).
+type CorporateActionStore interface {
+	GetCorporateActions() ([]CorporateAction, error)
+	InsertCorporateAction(action *CorporateAction) error
+	InsertCorporateActionIfMissing(action *CorporateAction) (bool, error)
+	UpdateCorporateAction(action CorporateAction) error
+	DeleteCorporateAction(id primitive.ObjectID) error
+}
+
+// Interface for storing the target allocations for rebalancing.
+type AllocationTargetStore interface {
+	GetAllocationTargets() ([]AllocationTarget, error)
+	InsertAllocationTarget(target *AllocationTarget) error
+	UpdateAllocationTarget(target AllocationTarget) error
+	DeleteAllocationTarget(id primitive.ObjectID) error
+}
+
+// Interface for storing the end-of-day snapshots of each equity type's portfolio. Storing a snapshot replaces any
+// existing one for the same equity type and date.
+type SnapshotStore interface {
+	StoreSnapshot(snapshot Snapshot) error
+	// Get the snapshots of an equity type between the start and end dates (inclusive), ordered by date.
+	GetSnapshots(equityType string, start time.Time, end time.Time) ([]Snapshot, error)
+	// Get the most recent snapshot of an equity type, or ErrNotFound if there are none.
+	GetLatestSnapshot(equityType string) (Snapshot, error)
+}
+
+// Interface for stores that can hold more than one quote for a ticker on the same date, and can remove them.
+type QuoteDeduplicator interface {
+	RemoveDuplicateQuotes() (int, error)
+}
+
+// Interface for all the data Polly persists.
+type Store interface {
+	PriceStore
+	CorporateActionStore
+	AllocationTargetStore
+	SnapshotStore
+}
+
+// Create and connect to the store selected in the server configuration. MongoDB is used by default.
+func NewStore(cfg *config.Configuration) (Store, error) {
+	switch cfg.Store {
+	case "", "mongodb":
+		mc := NewMongoDbClient()
+		if err := mc.ConnectMongoDb(cfg.MongoDbConnectionUri, cfg.MongoDbName); err != nil {
+			return nil, err
+		}
+		if migrated, err := mc.MigratePriceHistory(); err != nil {
+			log.Printf("WARNING: Unable to migrate price history to a single collection: %v", err)
+		} else if migrated > 0 {
+			log.Printf("Migrated the price history of %d tickers to a single collection", migrated)
+		}
+		mc.EnsurePriceIndex()
+		mc.EnsureSnapshotIndex()
+		return mc, nil
+	case "embedded":
+		if cfg.EmbeddedStoreFile == "" {
+			return nil, errors.New("No EmbeddedStoreFile configured for the embedded store")
+		}
+		return NewEmbeddedStore(cfg.EmbeddedStoreFile)
+	}
+	return nil, errors.New("Unknown store (" + cfg.Store + ")")
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestEmbeddedStore(t *testing.T) *EmbeddedStore {
+	store, err := NewEmbeddedStore(filepath.Join(t.TempDir(), "polly.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestEmbeddedStoreManagesCorporateActions(t *testing.T) {
+	store := newTestEmbeddedStore(t)
+	split := CorporateAction{Ticker: "ACME", Type: CorporateActionSplit, Date: time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC), Ratio: 2}
+
+	if inserted, err := store.InsertCorporateActionIfMissing(&split); err != nil || !inserted {
+		t.Fatalf("first insert = %v, %v", inserted, err)
+	}
+	duplicate := split
+	if inserted, err := store.InsertCorporateActionIfMissing(&duplicate); err != nil || inserted {
+		t.Fatalf("duplicate insert = %v, %v", inserted, err)
+	}
+	split.Ratio = 3
+	if err := store.UpdateCorporateAction(split); err != nil {
+		t.Fatal(err)
+	}
+	actions, err := store.GetCorporateActions()
+	if err != nil || len(actions) != 1 || actions[0].Ratio != 3 || actions[0].ID != split.ID {
+		t.Fatalf("actions = %#v, %v", actions, err)
+	}
+	if err = store.DeleteCorporateAction(primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleting a missing action = %v", err)
+	}
+	if err = store.DeleteCorporateAction(split.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmbeddedStoreReturnsOHLCVBarsByDate(t *testing.T) {
+	store := newTestEmbeddedStore(t)
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	store.StoreTickerData(Quote{
+		Symbol: "ACME",
+		Date:   []time.Time{day.AddDate(0, 0, 2), day, day.AddDate(0, 0, 1)},
+		Open:   []float64{12, 10, 11},
+		High:   []float64{13, 11, 12},
+		Low:    []float64{11, 9, 10},
+		Close:  []float64{12.5, 10.5, 11.5},
+		Volume: []float64{300, 100, 200},
+	})
+	// Closes without the optional bars are stored with zeros, and overwrite the existing date.
+	store.StoreTickerData(Quote{Symbol: "ACME", Date: []time.Time{day.AddDate(0, 0, 3), day.AddDate(0, 0, 2)}, Close: []float64{14, 13}})
+
+	quote := store.GetLatestTickerData("ACME", 3)
+
+	if len(quote.Date) != 3 || !quote.Date[0].Equal(day.AddDate(0, 0, 1)) || !quote.Date[2].Equal(day.AddDate(0, 0, 3)) {
+		t.Fatalf("latest ACME dates = %v", quote.Date)
+	}
+	bar := quote.Bar(0)
+	if bar.Open != 11 || bar.High != 12 || bar.Low != 10 || bar.Close != 11.5 || bar.Volume != 200 {
+		t.Fatalf("ACME bar = %#v", bar)
+	}
+	if bar = quote.Bar(1); bar.Close != 13 || bar.Open != 0 {
+		t.Fatalf("overwritten ACME bar = %#v", bar)
+	}
+	if quote = store.GetLatestTickerData("NONE", 3); len(quote.Date) != 0 {
+		t.Fatalf("unknown ticker history = %#v", quote)
+	}
+}
+
+func TestEmbeddedStoreReturnsLatestQuoteDateOfEachTicker(t *testing.T) {
+	store := newTestEmbeddedStore(t)
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	store.StoreTickerData(Quote{Symbol: "ACME", Date: []time.Time{day.AddDate(0, 0, 1), day}, Close: []float64{11, 10}})
+	store.StoreTickerData(Quote{Symbol: "BOLT", Date: []time.Time{day.AddDate(0, 0, 5)}, Close: []float64{20}})
+
+	latest := store.GetLatestQuoteDates()
+
+	if len(latest) != 2 || !latest["ACME"].Equal(day.AddDate(0, 0, 1)) || !latest["BOLT"].Equal(day.AddDate(0, 0, 5)) {
+		t.Fatalf("latest quote dates = %v", latest)
+	}
+}
+
+func TestEmbeddedStoreReplacesAndQueriesSnapshotsByDate(t *testing.T) {
+	store := newTestEmbeddedStore(t)
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	if _, err := store.GetLatestSnapshot("stock"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("latest snapshot of empty store error = %v", err)
+	}
+	for i, value := range []float64{100, 110, 120} {
+		if err := store.StoreSnapshot(Snapshot{EquityType: "stock", Date: day.AddDate(0, 0, i), MarketValue: value}); err != nil {
+			t.Fatalf("store snapshot: %v", err)
+		}
+	}
+	// A later refresh on the same day replaces that day's snapshot.
+	store.StoreSnapshot(Snapshot{EquityType: "stock", Date: day.AddDate(0, 0, 2), MarketValue: 125,
+		Holdings: []SnapshotHolding{{Ticker: "ACME", Shares: 10}}})
+	store.StoreSnapshot(Snapshot{EquityType: "etf", Date: day, MarketValue: 50})
+
+	latest, err := store.GetLatestSnapshot("stock")
+	if err != nil || latest.MarketValue != 125 || len(latest.Holdings) != 1 || latest.Holdings[0].Ticker != "ACME" {
+		t.Fatalf("latest stock snapshot = %#v, %v", latest, err)
+	}
+	snapshots, err := store.GetSnapshots("stock", day.AddDate(0, 0, 1), day.AddDate(0, 0, 5))
+	if err != nil || len(snapshots) != 2 || snapshots[0].MarketValue != 110 || snapshots[1].MarketValue != 125 {
+		t.Fatalf("stock snapshots = %#v, %v", snapshots, err)
+	}
+}
@@ -0,0 +1,169 @@
+package finance
+
+import (
+	"sort"
+	"time"
+)
+
+// Definition of the performance of a group of equities (e.g. a sector) over a period. Weight is the group's share
+// (%) of the portfolio's average invested capital, and Contribution its gain as a percentage of the portfolio's.
+type AttributionGroup struct {
+	Name         string   `json:"name"`
+	Equities     []string `json:"equities"`
+	Gain         float64  `json:"gain"`
+	Weight       float64  `json:"weight"`
+	Return       float64  `json:"return"`
+	Contribution float64  `json:"contribution"`
+	// Average invested capital over the period, weighting each flow by the time it was invested.
+	capital float64
+}
+
+// Definition of the attribution of a portfolio's return over a period to each sector, industry and equity type.
+type Attribution struct {
+	Start       time.Time          `json:"start"`
+	End         time.Time          `json:"end"`
+	Gain        float64            `json:"gain"`
+	Return      float64            `json:"return"`
+	Sectors     []AttributionGroup `json:"sectors"`
+	Industries  []AttributionGroup `json:"industries"`
+	EquityTypes []AttributionGroup `json:"equityTypes"`
+}
+
+// Get the value of this equity at the end of the given date, from its value history.
+func (s *Equity) valueOnDate(date time.Time) float64 {
+	lastDate := int64(0)
+	for historyDate := range s.ValueHistory {
+		if historyDate <= date.Unix() && historyDate > lastDate {
+			lastDate = historyDate
+		}
+	}
+	if lastDate == 0 {
+		return 0.0
+	}
+	// The history stops the day before a closed position was sold, so it's worth nothing from the sale on.
+	if closed := s.closedDate(); !closed.IsZero() && !closed.After(date) {
+		return 0.0
+	}
+	return s.ValueHistory[lastDate]
+}
+
+// Get the date a closed position was last sold (or merged away), or the zero time if it's still held.
+func (s *Equity) closedDate() time.Time {
+	var closed time.Time
+	if s.CurrentlyHeld {
+		return closed
+	}
+	for _, t := range s.transactions {
+		if (t.Action == "Sell" || t.Action == "Merger") && t.DateTime.After(closed) {
+			closed = t.DateTime
+		}
+	}
+	if closed.IsZero() {
+		return closed
+	}
+	return getUtcDate(closed)
+}
+
+// Calculate the gain of this equity over the period after the start date through the end date, including income
+// and fees, and its average invested capital (modified Dietz). Shares moved by mergers and spin-offs aren't flows,
+// so the value moved shows as a loss on the parent and a gain on the new company.
+func (s *Equity) periodGain(start time.Time, end time.Time) (float64, float64) {
+	startValue := s.valueOnDate(start)
+	gain := s.valueOnDate(end) - startValue
+	capital := startValue
+	periodDays := end.Sub(start).Hours() / 24
+	for _, t := range s.transactions {
+		date := getUtcDate(t.DateTime)
+		if !date.After(start) || date.After(end) {
+			continue
+		}
+		flow := 0.0
+		switch t.Action {
+		case "Buy":
+			flow = t.Value
+		case "Sell", "Merger":
+			flow = -t.Value
+		case "Dividend", "Interest":
+			gain += t.Value
+		case "Fee":
+			gain -= t.Value
+		}
+		gain -= flow
+		if periodDays > 0 {
+			capital += flow * end.Sub(date).Hours() / 24 / periodDays
+		}
+	}
+	return gain, capital
+}
+
+// Calculate the contribution of each sector, industry and equity type to the return of the given equities over the
+// period after the start date through the end date. Equities without a sector or industry (e.g. delisted or merged
+// stocks, which have no market data) are grouped under "Other".
+func CalculateAttribution(equities []*Equity, start time.Time, end time.Time) Attribution {
+	var a Attribution
+	a.Start = getUtcDate(start)
+	a.End = getUtcDate(end)
+	sectors := make(map[string]*AttributionGroup)
+	industries := make(map[string]*AttributionGroup)
+	equityTypes := make(map[string]*AttributionGroup)
+	totalCapital := 0.0
+	for _, s := range equities {
+		if s.Ticker == "CASH" {
+			continue
+		}
+		gain, capital := s.periodGain(a.Start, a.End)
+		if gain == 0 && capital == 0 {
+			continue
+		}
+		a.Gain += gain
+		totalCapital += capital
+		addToAttributionGroup(sectors, s.Sector, s.Ticker, gain, capital)
+		addToAttributionGroup(industries, s.Industry, s.Ticker, gain, capital)
+		addToAttributionGroup(equityTypes, s.EquityType, s.Ticker, gain, capital)
+	}
+	if totalCapital > 0.001 {
+		a.Return = a.Gain / totalCapital * 100.0
+	}
+	a.Sectors = finishAttributionGroups(sectors, totalCapital)
+	a.Industries = finishAttributionGroups(industries, totalCapital)
+	a.EquityTypes = finishAttributionGroups(equityTypes, totalCapital)
+	return a
+}
+
+// Helper function to add an equity's gain and capital to its group, creating the group if needed.
+func addToAttributionGroup(groups map[string]*AttributionGroup, name string, ticker string, gain float64, capital float64) {
+	if name == "" {
+		name = "Other"
+	}
+	group, ok := groups[name]
+	if !ok {
+		group = &AttributionGroup{Name: name}
+		groups[name] = group
+	}
+	group.Equities = append(group.Equities, ticker)
+	group.Gain += gain
+	group.capital += capital
+}
+
+// Helper function to calculate each group's weight, return and contribution, ordered by contribution.
+func finishAttributionGroups(groups map[string]*AttributionGroup, totalCapital float64) []AttributionGroup {
+	finished := make([]AttributionGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group.Equities)
+		if group.capital > 0.001 {
+			group.Return = group.Gain / group.capital * 100.0
+		}
+		if totalCapital > 0.001 {
+			group.Weight = group.capital / totalCapital * 100.0
+			group.Contribution = group.Gain / totalCapital * 100.0
+		}
+		finished = append(finished, *group)
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		if finished[i].Contribution != finished[j].Contribution {
+			return finished[i].Contribution > finished[j].Contribution
+		}
+		return finished[i].Name < finished[j].Name
+	})
+	return finished
+}
@@ -0,0 +1,231 @@
+package finance
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+// The benchmark used when none are configured.
+var DefaultBenchmarks = map[string]map[string]float64{"SPY": {"SPY": 1.0}}
+
+// Date the stored quote history of the S&P 500 and each benchmark ticker starts from.
+const benchmarkHistoryStart = "2015-01-01"
+
+// Definition of a benchmark to compare returns against: a single ticker, or a blend of tickers rebalanced daily to
+// their weights (e.g. 60% VT and 40% BND).
+type Benchmark struct {
+	Name    string             `json:"name"`
+	Weights map[string]float64 `json:"weights"`
+	History data.Quote         `json:"history"`
+}
+
+// Definition of the returns (%) of a benchmark over the same dates as a portfolio, and the portfolio's time-weighted
+// returns in excess of them.
+type BenchmarkComparison struct {
+	Annual               map[int]float64 `json:"annual"`
+	SinceInception       float64         `json:"sinceInception"`
+	ExcessAnnual         map[int]float64 `json:"excessAnnual"`
+	ExcessSinceInception float64         `json:"excessSinceInception"`
+}
+
+// Constructor for a new Benchmark, normalizing the weights of its tickers to sum to one.
+func NewBenchmark(name string, weights map[string]float64) (*Benchmark, error) {
+	var b Benchmark
+	b.Name = name
+	b.Weights = make(map[string]float64)
+	totalWeight := 0.0
+	for ticker, weight := range weights {
+		if weight <= 0 {
+			return nil, errors.New("Benchmark " + name + " requires a positive weight for " + ticker)
+		}
+		totalWeight += weight
+	}
+	if name == "" || totalWeight == 0 {
+		return nil, errors.New("Benchmark requires a name and at least one ticker")
+	}
+	for ticker, weight := range weights {
+		b.Weights[strings.ToUpper(ticker)] = weight / totalWeight
+	}
+	return &b, nil
+}
+
+// Build the benchmark's history from the daily quotes of each of its tickers. A single ticker uses its quotes as-is.
+// A blend is an index starting at 100, on the dates all of its tickers have a quote.
+func (b *Benchmark) BuildHistory(quotes map[string]data.Quote) {
+	if len(b.Weights) == 1 {
+		for ticker := range b.Weights {
+			b.History = quotes[ticker]
+		}
+		b.History.Symbol = b.Name
+		return
+	}
+	closes := make(map[string]map[time.Time]float64)
+	commonDates := make(map[time.Time]float64)
+	for ticker := range b.Weights {
+		closes[ticker] = closesByDate(quotes[ticker])
+	}
+	for date := range closes[b.tickers()[0]] {
+		inAll := true
+		for _, tickerCloses := range closes {
+			if _, ok := tickerCloses[date]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			commonDates[date] = 0.0
+		}
+	}
+	b.History = data.Quote{Symbol: b.Name}
+	value := 100.0
+	dates := sortedDates(commonDates)
+	for idx, date := range dates {
+		if idx > 0 {
+			// Rebalance to the target weights each day.
+			growth := 0.0
+			for ticker, weight := range b.Weights {
+				growth += weight * closes[ticker][date] / closes[ticker][dates[idx-1]]
+			}
+			value *= growth
+		}
+		b.History.Date = append(b.History.Date, date)
+		b.History.Close = append(b.History.Close, value)
+	}
+	if len(dates) == 0 {
+		log.Printf("WARNING: No common quote dates for the tickers of benchmark %s", b.Name)
+	}
+}
+
+// Get the benchmark's tickers in alphabetical order.
+func (b *Benchmark) tickers() []string {
+	tickers := make([]string, 0, len(b.Weights))
+	for ticker := range b.Weights {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	return tickers
+}
+
+// Compare the portfolio's time-weighted returns to the benchmark's returns over the dates of the portfolio's value
+// history.
+func (b *Benchmark) Compare(valueHistory map[time.Time]float64, portfolioReturns TimeWeightedReturns) BenchmarkComparison {
+	var bc BenchmarkComparison
+	bc.ExcessAnnual = make(map[int]float64)
+	dates := sortedDates(valueHistory)
+	benchmarkHistory := make(map[time.Time]float64)
+	if len(dates) > 0 {
+		for date, close := range closesByDate(b.History) {
+			if !date.Before(dates[0]) && !date.After(dates[len(dates)-1]) {
+				benchmarkHistory[date] = close
+			}
+		}
+	}
+	benchmarkReturns := CalculateTimeWeightedReturns(benchmarkHistory, nil)
+	bc.Annual = benchmarkReturns.Annual
+	bc.SinceInception = benchmarkReturns.SinceInception
+	for year, annual := range portfolioReturns.Annual {
+		bc.ExcessAnnual[year] = annual - bc.Annual[year]
+	}
+	bc.ExcessSinceInception = portfolioReturns.SinceInception - bc.SinceInception
+	return bc
+}
+
+// Helper function to get the closing price on (or near) the given date from a quote history. Dates without a quote
+// (e.g. weekends) use the nearest quote within a few days, and today uses the latest quote.
+func quoteOnDate(history data.Quote, quoteDate time.Time) (float64, bool) {
+	if len(history.Date) == 0 || len(history.Close) == 0 {
+		return 0.0, false
+	}
+	if idx := indexOf(getUtcDate(quoteDate), history.Date); idx != -1 {
+		return history.Close[idx], true
+	}
+	y1, m1, d1 := quoteDate.Date()
+	yNow, mNow, dNow := time.Now().Date()
+	if y1 == yNow && m1 == mNow && d1 == dNow {
+		// Likely don't have today's quote queried yet, just return the latest quote.
+		return history.Close[len(history.Close)-1], true
+	}
+	// Transaction likely occurred on a weekend. Try +/- a few days.
+	for i := 1; i < 4; i++ {
+		if idx := indexOf(getUtcDate(quoteDate.Add(time.Duration(-24*i)*time.Hour)), history.Date); idx != -1 {
+			return history.Close[idx], true
+		}
+		if idx := indexOf(getUtcDate(quoteDate.Add(time.Duration(24*i)*time.Hour)), history.Date); idx != -1 {
+			return history.Close[idx], true
+		}
+	}
+	return 0.0, false
+}
+
+// Calculate the return (%) of each benchmark over the life of a transaction, and the transaction's return in excess
+// of it. For a sale, the benchmark return is negated, as selling avoided the benchmark's later moves.
+func (s *Equity) calculateBenchmarkReturns(t *Transaction, isNeg float64) {
+	if len(s.benchmarks) == 0 {
+		return
+	}
+	t.BenchmarkReturns = make(map[string]float64)
+	t.BenchmarkExcessReturns = make(map[string]float64)
+	for _, b := range s.benchmarks {
+		if benchmarkReturn, ok := transactionBenchmarkReturn(b.History, t.DateTime, isNeg); ok {
+			t.BenchmarkReturns[b.Name] = benchmarkReturn
+			t.BenchmarkExcessReturns[b.Name] = t.TotalReturn - benchmarkReturn
+		}
+	}
+}
+
+// Helper function to calculate the return (%) of a quote history from a transaction's date to now, negated for a
+// sale. Returns false if either quote is missing.
+func transactionBenchmarkReturn(history data.Quote, txnDate time.Time, isNeg float64) (float64, bool) {
+	then, okThen := quoteOnDate(history, txnDate)
+	now, okNow := quoteOnDate(history, time.Now())
+	if !okThen || !okNow || then <= 0 {
+		return 0.0, false
+	}
+	return isNeg * ((now - then) / then) * 100.0, true
+}
+
+// Compare the portfolio's time-weighted returns to each benchmark, keyed by benchmark name.
+func CompareBenchmarks(benchmarks []*Benchmark, valueHistory map[time.Time]float64, portfolioReturns TimeWeightedReturns) map[string]BenchmarkComparison {
+	comparisons := make(map[string]BenchmarkComparison)
+	for _, b := range benchmarks {
+		comparisons[b.Name] = b.Compare(valueHistory, portfolioReturns)
+	}
+	return comparisons
+}
+
+// Make sure the quote history of the S&P 500 and each benchmark ticker is up-to-date (2015 to present), then build
+// each benchmark's history from them.
+func (ec *EquityCatalogue) RetrieveBenchmarkHistories() {
+	ec.refreshBenchmarkHistory("SPY")
+	ec.sp500quotes = ec.dbClient.GetTickerData("SPY")
+	quotes := map[string]data.Quote{"SPY": ec.sp500quotes}
+	for _, b := range ec.benchmarks {
+		for _, ticker := range b.tickers() {
+			if _, ok := quotes[ticker]; ok {
+				continue
+			}
+			ec.refreshBenchmarkHistory(ticker)
+			quotes[ticker] = ec.dbClient.GetTickerData(ticker)
+		}
+		b.BuildHistory(quotes)
+	}
+}
+
+// Make sure the stored quote history of a benchmark ticker is up-to-date, from the benchmark history start. Benchmark
+// tickers are queried as configured, whatever the catalogue's equity type.
+func (ec *EquityCatalogue) refreshBenchmarkHistory(ticker string) {
+	startDate := benchmarkHistoryStart
+	if latestDate, ok := ec.latestQuoteDate(ticker); ok {
+		// Are we up to date on the quotes? More than 3 days have passed?
+		if time.Now().Sub(latestDate).Hours() <= 72 {
+			return
+		}
+		startDate = latestDate.Add(24 * time.Hour).UTC().Format("2006-01-02")
+	}
+	ec.retrieveAndStoreHistory(ticker, ticker, startDate, time.Now().UTC().Format("2006-01-02"))
+}
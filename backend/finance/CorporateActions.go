@@ -0,0 +1,388 @@
+package finance
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+// Helper function to define a split in the default corporate actions.
+func defaultSplit(ticker string, year int, month time.Month, day int, ratio float64) data.CorporateAction {
+	return data.CorporateAction{Ticker: ticker, Type: data.CorporateActionSplit,
+		Date: time.Date(year, month, day, 0, 0, 0, 0, time.UTC), Ratio: ratio}
+}
+
+// Helper function to define a delisting in the default corporate actions.
+func defaultDelisting(ticker string, description string) data.CorporateAction {
+	return data.CorporateAction{Ticker: ticker, Type: data.CorporateActionDelisting, Description: description}
+}
+
+// Corporate actions relevant to our portfolio, used to seed an empty corporate actions store.
+var DefaultCorporateActions = []data.CorporateAction{
+	defaultSplit("TSLA", 2020, time.August, 31, 5),
+	defaultSplit("TSLA", 2022, time.August, 25, 3),
+	defaultSplit("NVDA", 2021, time.July, 20, 4),
+	defaultSplit("NVDA", 2024, time.June, 7, 10),
+	defaultSplit("SHOP", 2022, time.June, 29, 10),
+	defaultSplit("AMZN", 2022, time.June, 6, 20),
+	defaultSplit("GOOG", 2022, time.July, 18, 20),
+	defaultSplit("GOOGL", 2022, time.July, 18, 20),
+	defaultSplit("IAU", 2021, time.May, 24, 0.5),
+	defaultSplit("CELH", 2023, time.November, 15, 3),
+	defaultDelisting("VYGVF", "Voyager Digital Ltd. Went bankrupt in 2022"),
+	defaultDelisting("APPH", "AppHarvest Inc. Delisted from Nasdaq in July 2023 to OTC as APPH.Q"),
+	defaultDelisting("PTRA", "Proterra Inc. Delisted from Nasdaq in August 2023, filed for bankrupcy"),
+	defaultDelisting("FFIE", "Faraday Future Intelligent Electric Inc. Delisted from Nasdaq in May 2024, failed to comply with listing rules"),
+	defaultDelisting("DMTK", "Dermtech Inc. Delisted from Nasdaq in June 2024, filed for bankrupcy"),
+	{Ticker: "XLNX", Type: data.CorporateActionMerger, Date: time.Date(2022, time.February, 14, 0, 0, 0, 0, time.UTC),
+		NewTicker: "AMD", Ratio: 1.7234, Description: "Xilinx Inc. Bought by AMD"},
+	{Ticker: "ML", Type: data.CorporateActionMerger, Date: time.Date(2025, time.April, 17, 0, 0, 0, 0, time.UTC),
+		CashPerShare: 82, Description: "MoneyLion. Bought by Gen Digital for $82 cash per share (plus a CVR, not tracked)"},
+	// Half of the $5.50 per share was paid in CoStar stock, so half of the basis carries to it.
+	{Ticker: "MTTR", Type: data.CorporateActionMerger, Date: time.Date(2025, time.February, 28, 0, 0, 0, 0, time.UTC),
+		NewTicker: "CSGP", Ratio: 0.03, CashPerShare: 2.75, BasisAllocation: 0.5,
+		Description: "Matterport. Bought by CoStar for $2.75 cash plus $2.75 of CoStar stock per share"},
+	defaultDelisting("PONDX", "PIMCO Income Fund Class D. Delisted mutual fund in 2022"),
+}
+
+// A thread-safe lookup of corporate actions by ticker, applied while processing each equity.
+type CorporateActionRegistry struct {
+	mutex    sync.RWMutex
+	splits   map[string][]Transaction
+	delisted map[string]bool
+	renames  map[string]string
+	// Mergers and spin-offs, which move shares between tickers.
+	conversions []data.CorporateAction
+}
+
+// Constructor for a new CorporateActionRegistry, loaded with the given corporate actions.
+func NewCorporateActionRegistry(actions []data.CorporateAction) *CorporateActionRegistry {
+	var r CorporateActionRegistry
+	r.Load(actions)
+	return &r
+}
+
+// The registry of corporate actions used by all equity catalogues. Loaded with the defaults until the store is read.
+var corporateActionRegistry = NewCorporateActionRegistry(DefaultCorporateActions)
+
+// Replace the corporate actions applied by all equity catalogues (e.g. after reading or editing the store).
+func SetCorporateActions(actions []data.CorporateAction) {
+	corporateActionRegistry.Load(actions)
+}
+
+// Replace the contents of this registry with the given corporate actions.
+func (r *CorporateActionRegistry) Load(actions []data.CorporateAction) {
+	splits := make(map[string][]Transaction)
+	delisted := make(map[string]bool)
+	renames := make(map[string]string)
+	conversions := make([]data.CorporateAction, 0)
+	for _, action := range actions {
+		switch action.Type {
+		case data.CorporateActionSplit:
+			// Splits are applied as pseudo-transactions at the start of the day, ahead of any midday trades.
+			splits[action.Ticker] = append(splits[action.Ticker], Transaction{
+				Ticker:   action.Ticker,
+				DateTime: getUtcDate(action.Date),
+				Action:   "Split",
+				Shares:   action.Ratio})
+		case data.CorporateActionDelisting:
+			delisted[action.Ticker] = true
+		case data.CorporateActionRename:
+			renames[action.Ticker] = action.NewTicker
+		case data.CorporateActionMerger, data.CorporateActionSpinOff:
+			conversions = append(conversions, action)
+		}
+	}
+	sort.SliceStable(conversions, func(i, j int) bool {
+		return conversions[i].Date.Before(conversions[j].Date)
+	})
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.splits = splits
+	r.delisted = delisted
+	r.renames = renames
+	r.conversions = conversions
+}
+
+// Get a copy of the split pseudo-transactions for the given ticker.
+func (r *CorporateActionRegistry) Splits(ticker string) []Transaction {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]Transaction(nil), r.splits[ticker]...)
+}
+
+// Check if the given ticker no longer trades on an exchange.
+func (r *CorporateActionRegistry) IsDelisted(ticker string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.delisted[ticker]
+}
+
+// Get a copy of the mergers and spin-offs, ordered by date.
+func (r *CorporateActionRegistry) Conversions() []data.CorporateAction {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]data.CorporateAction(nil), r.conversions...)
+}
+
+// Check if the given ticker was merged into another company or acquired.
+func (r *CorporateActionRegistry) IsMerged(ticker string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, action := range r.conversions {
+		if action.Type == data.CorporateActionMerger && action.Ticker == ticker {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the current symbol for the given ticker, following any chain of renames.
+func (r *CorporateActionRegistry) CurrentTicker(ticker string) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	// Limit the number of hops, in case renames were entered in a loop.
+	for i := 0; i < len(r.renames); i++ {
+		newTicker, ok := r.renames[ticker]
+		if !ok {
+			break
+		}
+		ticker = newTicker
+	}
+	return ticker
+}
+
+// Check if market data should not be queried for the given ticker (delisted, merged, or our cash placeholder symbol).
+func skipMarketData(ticker string) bool {
+	return ticker == "CASH" || corporateActionRegistry.IsDelisted(ticker) || corporateActionRegistry.IsMerged(ticker)
+}
+
+// SplitHistoryProvider is implemented by market data providers able to report a ticker's split history.
+type SplitHistoryProvider interface {
+	GetSplitHistory(ticker string) ([]data.CorporateAction, error)
+}
+
+// Query the market data provider for the split history of each equity in the catalogue, if the provider supports it.
+func (ec *EquityCatalogue) RetrieveSplitHistory() []data.CorporateAction {
+	actions := make([]data.CorporateAction, 0)
+	splitProvider, ok := ec.marketData.(SplitHistoryProvider)
+	if !ok || ec.equityType == "crypto" {
+		return actions
+	}
+	for ticker := range ec.equities {
+		if skipMarketData(ticker) {
+			continue
+		}
+		splits, err := splitProvider.GetSplitHistory(ticker)
+		if err != nil {
+			log.Printf("WARNING: Couldn't get split history for %s: %v", ticker, err)
+			continue
+		}
+		actions = append(actions, splits...)
+	}
+	return actions
+}
+
+// Get the fraction of a merged equity's cost basis carried to the acquirer's shares. The rest is the basis of the
+// cash portion of the consideration.
+func mergerBasisAllocation(merger data.CorporateAction) float64 {
+	if merger.NewTicker == "" {
+		return 0.0
+	} else if merger.CashPerShare <= 0 {
+		return 1.0
+	}
+	return merger.BasisAllocation
+}
+
+// Apply the mergers and spin-offs to the catalogue's equities in date order, so shares received from one action carry
+// through any later action.
+func (ec *EquityCatalogue) ApplyShareConversions() {
+	for _, action := range corporateActionRegistry.Conversions() {
+		switch action.Type {
+		case data.CorporateActionMerger:
+			ec.applyMerger(action)
+		case data.CorporateActionSpinOff:
+			ec.applySpinOff(action)
+		}
+	}
+}
+
+// Convert the holdings of a merged or acquired equity into shares of the acquirer and/or cash on the merger date.
+// Each open lot carries its acquisition date and (allocated) cost basis forward into a lot of the acquirer.
+func (ec *EquityCatalogue) applyMerger(merger data.CorporateAction) {
+	s, ok := ec.equities[merger.Ticker]
+	date := getUtcDate(merger.Date)
+	if !ok || s.hasTransaction("Merger", date) {
+		return
+	}
+	lots := s.openLotsBefore(date)
+	shares := 0.0
+	for _, lot := range lots {
+		shares += lot.Shares
+	}
+	// Close the merged equity's lots on the merger date, and receive any cash portion.
+	closing := Transaction{
+		Ticker:          s.Ticker,
+		DateTime:        date,
+		Action:          "Merger",
+		Shares:          shares,
+		Price:           merger.CashPerShare,
+		Value:           shares * merger.CashPerShare,
+		basisAllocation: mergerBasisAllocation(merger)}
+	price := 0.0
+	if merger.NewTicker != "" && shares >= lotShareTolerance {
+		price = ec.conversionPrice(merger)
+		closing.movedValue = shares * merger.Ratio * price
+	}
+	s.transactions = append(s.transactions, closing)
+	s.merged = true
+	if closing.Value > 0 {
+		ec.transactions = append(ec.transactions, closing)
+	}
+	if merger.NewTicker == "" || shares < lotShareTolerance {
+		log.Printf("Merger: %s converted %f shares to $%f cash", s.Ticker, shares, closing.Value)
+		return
+	}
+	ec.receiveLots(s, merger, "MergerReceived", lots, closing.basisAllocation, price)
+	log.Printf("Merger: %s converted %f shares to %f shares of %s and $%f cash", s.Ticker, shares,
+		shares*merger.Ratio, merger.NewTicker, closing.Value)
+}
+
+// Distribute shares of a spun-off company to the holders of the parent equity on the spin-off date, moving the
+// allocated fraction of each parent lot's cost basis to a lot of the new company with the same acquisition date.
+func (ec *EquityCatalogue) applySpinOff(spinOff data.CorporateAction) {
+	s, ok := ec.equities[spinOff.Ticker]
+	date := getUtcDate(spinOff.Date)
+	if !ok || s.hasTransaction("SpinOff", date) {
+		return
+	}
+	lots := s.openLotsBefore(date)
+	shares := 0.0
+	for _, lot := range lots {
+		shares += lot.Shares
+	}
+	if shares < lotShareTolerance {
+		return
+	}
+	// Reduce the basis of the parent's lots on the spin-off date.
+	price := ec.conversionPrice(spinOff)
+	s.transactions = append(s.transactions, Transaction{
+		Ticker:          s.Ticker,
+		DateTime:        date,
+		Action:          "SpinOff",
+		Shares:          shares,
+		basisAllocation: spinOff.BasisAllocation,
+		movedValue:      shares * spinOff.Ratio * price})
+	ec.receiveLots(s, spinOff, "SpinOffReceived", lots, spinOff.BasisAllocation, price)
+	log.Printf("Spin-off: %s holders received %f shares of %s", s.Ticker, shares*spinOff.Ratio, spinOff.NewTicker)
+}
+
+// Get the closing price of the new ticker of a merger or spin-off on its date, to value the shares moved between
+// tickers. Its price history is retrieved first if the store doesn't reach that date yet. Returns zero if no price is
+// available, in which case the shares moved are valued at cost basis.
+func (ec *EquityCatalogue) conversionPrice(action data.CorporateAction) float64 {
+	date := getUtcDate(action.Date)
+	if ec.dbClient != nil {
+		if latestDate, ok := ec.latestQuoteDate(action.NewTicker); !ok || latestDate.Before(date) {
+			ec.RefreshStockHistory(&[]Transaction{{Ticker: action.NewTicker, DateTime: date}}, true)
+		}
+		history := ec.dbClient.GetTickerDataRange(action.NewTicker, date.AddDate(0, 0, -7), date.AddDate(0, 0, 7))
+		if price, ok := quoteOnDate(history, date); ok {
+			return price
+		}
+	}
+	log.Printf("WARNING: No %s price on %s, valuing the shares moved from %s at cost basis", action.NewTicker,
+		date.Format("2006-01-02"), action.Ticker)
+	return 0.0
+}
+
+// Add a lot of the action's new ticker for each open lot of the given equity, with the ratio of shares and the
+// allocated fraction of basis, creating the new equity if we don't already hold it. Each lot records the market value
+// of its shares at the given price (if known), to value the shares moved in money-weighted returns.
+func (ec *EquityCatalogue) receiveLots(s *Equity, action data.CorporateAction, txnAction string, lots []Transaction, basisAllocation float64, price float64) {
+	equity, ok := ec.equities[action.NewTicker]
+	if !ok {
+		equity, _ = NewEquity(action.NewTicker, s.EquityType)
+		equity.costBasisMethod = ec.costBasisMethod
+		ec.equities[action.NewTicker] = equity
+	}
+	for _, lot := range lots {
+		received := Transaction{
+			Ticker:   action.NewTicker,
+			DateTime: getUtcDate(action.Date),
+			Action:   txnAction,
+			Shares:   lot.Shares * action.Ratio,
+			Price:    lot.Price * basisAllocation / action.Ratio,
+			LotId:    lot.LotId,
+			acquired: lot.acquisitionDate()}
+		received.Value = received.Shares * received.Price
+		received.movedValue = received.Shares * price
+		equity.transactions = append(equity.transactions, received)
+	}
+}
+
+// Check if this equity has a transaction with the given action and date.
+func (s *Equity) hasTransaction(action string, date time.Time) bool {
+	for _, txn := range s.transactions {
+		if txn.Action == action && txn.DateTime.Equal(date) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the open lots of this equity just before the given date, by processing a copy of its transactions and splits.
+func (s *Equity) openLotsBefore(date time.Time) []Transaction {
+	sim, _ := NewEquity(s.Ticker, s.EquityType)
+	sim.costBasisMethod = s.costBasisMethod
+	sim.transactions = append(append(sim.transactions, s.transactions...), corporateActionRegistry.Splits(s.Ticker)...)
+	sort.SliceStable(sim.transactions, func(i, j int) bool {
+		return sim.transactions[i].DateTime.Before(sim.transactions[j].DateTime)
+	})
+	curShares := 0.0
+	for idx := 0; idx < len(sim.transactions) && sim.transactions[idx].DateTime.Before(date); idx++ {
+		curShares = sim.CalculateTransactionData(idx, curShares)
+	}
+	return sim.buyQ
+}
+
+// Close all open lots of a merged equity. The cash portion of the consideration realizes a gain against the part of
+// each lot's basis not carried over to the acquirer's shares.
+func (s *Equity) closeMergedLots(t *Transaction) {
+	// The cash received, and the market value of the acquirer's shares, are returned from this equity.
+	s.addInvestmentFlow(t.DateTime, t.Value+t.movedValue)
+	for _, lot := range s.buyQ {
+		if t.movedValue == 0 {
+			// Without the acquirer's price, the basis carried to its shares is returned instead.
+			s.addInvestmentFlow(t.DateTime, lot.Shares*lot.Price*t.basisAllocation)
+		}
+		if t.Price > 0 {
+			cashLot := lot
+			cashLot.Price = lot.Price * (1 - t.basisAllocation)
+			s.RealizedGain += (t.Price - cashLot.Price) * lot.Shares
+			s.recordClosedLot(t, &cashLot, lot.Shares)
+		}
+	}
+	s.buyQ = make([]Transaction, 0)
+}
+
+// Move the allocated fraction of each open lot's cost basis to the shares of a spun-off company.
+func (s *Equity) reduceSpunOffBasis(t *Transaction) {
+	// The market value of the new company's shares is returned from this equity.
+	s.addInvestmentFlow(t.DateTime, t.movedValue)
+	for i := range s.buyQ {
+		if t.movedValue == 0 {
+			// Without the new company's price, the basis moved to its shares is returned instead.
+			s.addInvestmentFlow(t.DateTime, s.buyQ[i].Shares*s.buyQ[i].Price*t.basisAllocation)
+		}
+		s.buyQ[i].Price *= 1 - t.basisAllocation
+	}
+}
+
+// Check if the action opens a lot of shares received from a merger or spin-off, rather than purchased.
+func isReceivedShares(action string) bool {
+	return action == "MergerReceived" || action == "SpinOffReceived"
+}
@@ -0,0 +1,175 @@
+package finance
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Supported methods for matching sold shares against open lots.
+const (
+	// First-in, first-out: sell the oldest lots first.
+	CostBasisFIFO = "FIFO"
+	// Last-in, first-out: sell the newest lots first.
+	CostBasisLIFO = "LIFO"
+	// Highest-in, first-out: sell the lots with the highest unit cost first.
+	CostBasisHIFO = "HIFO"
+	// Average cost: sell an equal fraction of every open lot, realizing gains against the average unit cost.
+	CostBasisAverage = "AverageCost"
+	// Specific lot: sell the lot IDs named on the sale, then fall back to FIFO for any remaining shares.
+	CostBasisSpecificLot = "SpecificLot"
+)
+
+// Shares below this amount are considered fully sold, to account for minor accounting differences.
+const lotShareTolerance = 0.000001
+
+// Verify the given cost basis method is one of the supported methods.
+func ValidateCostBasisMethod(method string) error {
+	switch method {
+	case CostBasisFIFO, CostBasisLIFO, CostBasisHIFO, CostBasisAverage, CostBasisSpecificLot:
+		return nil
+	}
+	return errors.New("Invalid cost basis method (" + method + ")")
+}
+
+// Set the default method used to match sales against open lots for this equity.
+func (s *Equity) SetCostBasisMethod(method string) error {
+	if err := ValidateCostBasisMethod(method); err != nil {
+		return err
+	}
+	s.costBasisMethod = method
+	return nil
+}
+
+// Match the shares of a sale against open lots in the buy queue, using the sale's cost basis method override
+// (if any) or the equity's default method, and add the realized gain. Returns an error if the sale has more shares
+// than the open lots, leaving the extra shares unmatched.
+func (s *Equity) sellShares(t *Transaction) error {
+	method := s.costBasisMethod
+	if t.CostBasisMethod != "" {
+		method = t.CostBasisMethod
+	}
+	remainingShares := t.Shares
+	// Sell any specifically identified lots first.
+	if t.LotId != "" {
+		for _, lotId := range strings.Split(t.LotId, ",") {
+			lotIdx := s.findLot(strings.TrimSpace(lotId))
+			if lotIdx == -1 {
+				log.Printf("WARNING: Lot %s not found for %s sale on %s", lotId, s.Ticker, t.DateTime.Format("2006-01-02"))
+				continue
+			}
+			remainingShares = s.sellFromLot(t, lotIdx, remainingShares)
+			if remainingShares <= 0 {
+				return nil
+			}
+		}
+	}
+	if method == CostBasisAverage {
+		remainingShares = s.sellAverageCost(t, remainingShares)
+	}
+	for remainingShares > 0 {
+		// Make sure we have buys to cover remaining shares in the sell.
+		lotIdx := s.nextLotIndex(method)
+		if lotIdx == -1 {
+			// Reinvested dividends are recorded as ReinvestedDividend lots, so the transactions are missing a buy.
+			return fmt.Errorf("%s sale on %s is oversold by %f shares", s.Ticker, t.DateTime.Format("2006-01-02"), remainingShares)
+		}
+		remainingShares = s.sellFromLot(t, lotIdx, remainingShares)
+	}
+	return nil
+}
+
+// Find the index of the open lot with the given ID, or -1 if not found.
+func (s *Equity) findLot(lotId string) int {
+	for idx, lot := range s.buyQ {
+		if lot.LotId != "" && lot.LotId == lotId {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Get the index of the next open lot to sell per the cost basis method, or -1 if no lots remain.
+func (s *Equity) nextLotIndex(method string) int {
+	if len(s.buyQ) == 0 {
+		return -1
+	}
+	switch method {
+	case CostBasisLIFO:
+		return len(s.buyQ) - 1
+	case CostBasisHIFO:
+		highestIdx := 0
+		for idx, lot := range s.buyQ {
+			if lot.Price > s.buyQ[highestIdx].Price {
+				highestIdx = idx
+			}
+		}
+		return highestIdx
+	default:
+		return 0
+	}
+}
+
+// Sell up to the remaining shares from a single open lot, removing the lot once exhausted. Returns the shares
+// of the sale still to be matched.
+func (s *Equity) sellFromLot(t *Transaction, lotIdx int, remainingShares float64) float64 {
+	lot := &s.buyQ[lotIdx]
+	matchedShares := remainingShares
+	if lot.Shares < matchedShares {
+		matchedShares = lot.Shares
+	}
+	s.RealizedGain += (t.netPrice() - lot.Price) * matchedShares
+	s.recordClosedLot(t, lot, matchedShares)
+	lot.Shares -= matchedShares
+	if lot.Shares < lotShareTolerance {
+		s.buyQ = append(s.buyQ[:lotIdx], s.buyQ[lotIdx+1:]...)
+	}
+	remainingShares -= matchedShares
+	if remainingShares < lotShareTolerance {
+		remainingShares = 0
+	}
+	return remainingShares
+}
+
+// Sell an equal fraction of every open lot, so the realized gain is measured against the average unit cost and
+// the average cost of the remaining shares is unchanged. Returns the shares of the sale still to be matched.
+func (s *Equity) sellAverageCost(t *Transaction, remainingShares float64) float64 {
+	totalShares := 0.0
+	for _, lot := range s.buyQ {
+		totalShares += lot.Shares
+	}
+	if totalShares < lotShareTolerance {
+		return remainingShares
+	}
+	fraction := remainingShares / totalShares
+	if fraction > 1.0 {
+		fraction = 1.0
+	}
+	// Iterate in reverse, so exhausted lots can be removed while iterating.
+	for lotIdx := len(s.buyQ) - 1; lotIdx >= 0; lotIdx-- {
+		lotShares := s.buyQ[lotIdx].Shares * fraction
+		s.sellFromLot(t, lotIdx, lotShares)
+		remainingShares -= lotShares
+	}
+	if remainingShares < lotShareTolerance {
+		remainingShares = 0
+	}
+	return remainingShares
+}
+
+// Record the shares of an open lot closed by a sale, for tax reporting.
+func (s *Equity) recordClosedLot(t *Transaction, lot *Transaction, shares float64) {
+	var closed ClosedLot
+	closed.Ticker = s.Ticker
+	closed.LotId = lot.LotId
+	closed.Shares = shares
+	closed.DateAcquired = lot.acquisitionDate()
+	closed.DateSold = t.DateTime
+	closed.Proceeds = shares * t.netPrice()
+	closed.CostBasis = shares * lot.Price
+	closed.LongTerm = isLongTermHolding(closed.DateAcquired, t.DateTime)
+	closed.sourceLot = int(lot.id)
+	closed.Gain = closed.Proceeds - closed.CostBasis
+	s.closedLots = append(s.closedLots, closed)
+}
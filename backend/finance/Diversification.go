@@ -0,0 +1,123 @@
+package finance
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Default lookback (in days) and number of top holdings for diversification reports.
+const (
+	DefaultCorrelationLookbackDays = 365
+	DefaultTopHoldings             = 5
+)
+
+// Definition of a holding's share (%) of a portfolio's market value.
+type HoldingWeight struct {
+	Ticker string  `json:"ticker"`
+	Weight float64 `json:"weight"`
+}
+
+// Definition of the diversification of a portfolio's current holdings: the pairwise correlations of their daily
+// returns over the lookback (in the order of Tickers), and the concentration of their market value.
+type DiversificationReport struct {
+	Start        time.Time       `json:"start"`
+	End          time.Time       `json:"end"`
+	Tickers      []string        `json:"tickers"`
+	Correlations [][]float64     `json:"correlations"`
+	Holdings     []HoldingWeight `json:"holdings"`
+	// Combined weight (%) of the largest holdings.
+	TopHoldings int     `json:"topHoldings"`
+	TopWeight   float64 `json:"topWeight"`
+	// Sum of the squared weights (from 1/N for equal weights, to 1 for a single holding), and its inverse.
+	Herfindahl        float64 `json:"herfindahl"`
+	EffectiveHoldings float64 `json:"effectiveHoldings"`
+}
+
+// Calculate the diversification of the currently held equities, with correlations over the lookback days before the
+// end date.
+func CalculateDiversification(equities []*Equity, lookbackDays int, topHoldings int, end time.Time) DiversificationReport {
+	var dr DiversificationReport
+	dr.End = getUtcDate(end)
+	dr.Start = dr.End.AddDate(0, 0, -lookbackDays)
+	dr.TopHoldings = topHoldings
+	held := make([]*Equity, 0)
+	totalValue := 0.0
+	for _, s := range equities {
+		if s.Ticker != "CASH" && s.CurrentlyHeld && s.MarketValue > 0 {
+			held = append(held, s)
+			totalValue += s.MarketValue
+		}
+	}
+	// Order the holdings by weight, largest first.
+	sort.Slice(held, func(i, j int) bool {
+		if held[i].MarketValue != held[j].MarketValue {
+			return held[i].MarketValue > held[j].MarketValue
+		}
+		return held[i].Ticker < held[j].Ticker
+	})
+	closes := make([]map[time.Time]float64, len(held))
+	for idx, s := range held {
+		weight := s.MarketValue / totalValue
+		dr.Tickers = append(dr.Tickers, s.Ticker)
+		dr.Holdings = append(dr.Holdings, HoldingWeight{Ticker: s.Ticker, Weight: weight * 100.0})
+		dr.Herfindahl += weight * weight
+		if idx < topHoldings {
+			dr.TopWeight += weight * 100.0
+		}
+		closes[idx] = make(map[time.Time]float64)
+		for date, close := range closesByDate(s.priceHistory) {
+			if !date.Before(dr.Start) && !date.After(dr.End) {
+				closes[idx][date] = close
+			}
+		}
+	}
+	if dr.Herfindahl > 0 {
+		dr.EffectiveHoldings = 1 / dr.Herfindahl
+	}
+	dr.Correlations = make([][]float64, len(held))
+	for i := range held {
+		dr.Correlations[i] = make([]float64, len(held))
+		dr.Correlations[i][i] = 1.0
+		for j := 0; j < i; j++ {
+			dr.Correlations[i][j] = correlateCloses(closes[i], closes[j])
+			dr.Correlations[j][i] = dr.Correlations[i][j]
+		}
+	}
+	return dr
+}
+
+// Calculate the correlation of the daily returns of two price histories, between the dates both have a close.
+// Returns zero if there are too few returns, or either history is flat.
+func correlateCloses(closesA map[time.Time]float64, closesB map[time.Time]float64) float64 {
+	common := make(map[time.Time]float64)
+	for date := range closesA {
+		if _, ok := closesB[date]; ok {
+			common[date] = 0.0
+		}
+	}
+	dates := sortedDates(common)
+	returnsA := make([]float64, 0, len(dates))
+	returnsB := make([]float64, 0, len(dates))
+	for idx := 1; idx < len(dates); idx++ {
+		prevA, prevB := closesA[dates[idx-1]], closesB[dates[idx-1]]
+		if prevA > 0 && prevB > 0 {
+			returnsA = append(returnsA, closesA[dates[idx]]/prevA-1)
+			returnsB = append(returnsB, closesB[dates[idx]]/prevB-1)
+		}
+	}
+	if len(returnsA) < 2 {
+		return 0.0
+	}
+	meanA, meanB := mean(returnsA), mean(returnsB)
+	covariance, varianceA, varianceB := 0.0, 0.0, 0.0
+	for idx := range returnsA {
+		covariance += (returnsA[idx] - meanA) * (returnsB[idx] - meanB)
+		varianceA += (returnsA[idx] - meanA) * (returnsA[idx] - meanA)
+		varianceB += (returnsB[idx] - meanB) * (returnsB[idx] - meanB)
+	}
+	if varianceA == 0 || varianceB == 0 {
+		return 0.0
+	}
+	return covariance / math.Sqrt(varianceA*varianceB)
+}
@@ -27,9 +27,13 @@ type Equity struct {
 	NumShares                       float64           `json:"numShares"`
 	CurrentlyHeld                   bool              `json:"currentlyHeld"`
 	RealizedGain                    float64           `json:"realizedGain"`
+	IncomeReceived                  float64           `json:"incomeReceived"`
+	FeesPaid                        float64           `json:"feesPaid"`
 	UnrealizedGain                  float64           `json:"unrealizedGain"`
 	UnrealizedGainPercentage        float64           `json:"unrealizedGainPercentage"`
 	TotalGain                       float64           `json:"totalGain"`
+	MoneyWeightedReturn             float64           `json:"moneyWeightedReturn"`
+	Risk                            RiskMetrics       `json:"risk"`
 	ValueAllTimeHigh                float64           `json:"valueAllTimeHigh"`
 	HoldingDays                     uint              `json:"holdingDays"` // TODO: Calculate this and use it...
 	Sector                          string            `json:"sector"`
@@ -49,11 +53,16 @@ type Equity struct {
 	ForwardPE                       float64           `json:"forwardPE"`
 	ValueHistory                    map[int64]float64 `json:"valueHistory"`
 	// Some arrays/objects to support metric calculation.
-	buyQ          []Transaction
-	priceHistory  data.Quote
-	sp500History  data.Quote
-	splitMultiple float64
-	transactions  []Transaction
+	buyQ            []Transaction
+	closedLots      []ClosedLot
+	costBasisMethod string
+	investmentFlows []CashFlow
+	merged          bool
+	priceHistory    data.Quote
+	sp500History    data.Quote
+	benchmarks      []*Benchmark
+	splitMultiple   float64
+	transactions    []Transaction
 	// Financial history data
 	revenueUnits                   string
 	fcfTtm                         float64
@@ -82,8 +91,11 @@ func NewEquity(tkr string, eqType string) (*Equity, error) {
 	s.EquityType = eqType
 	s.ValueHistory = make(map[int64]float64)
 	s.transactions = make([]Transaction, 0)
-	// Create a slice to use as a FIFO queue for calculating metrics.
+	// Create a slice to hold the open lots for calculating metrics, matched per the cost basis method.
 	s.buyQ = make([]Transaction, 0)
+	s.closedLots = make([]ClosedLot, 0)
+	s.investmentFlows = make([]CashFlow, 0)
+	s.costBasisMethod = CostBasisFIFO
 	s.splitMultiple = 1.0
 	// Create slices for the financial data.
 	s.quarterlyDates = make([]string, 0)
@@ -129,39 +141,6 @@ func (s *Equity) getMaxValueFromHistory() {
 	s.ValueAllTimeHigh = max
 }
 
-func (s *Equity) GetQuoteOfSP500(quoteDate time.Time) float64 {
-	if len(s.sp500History.Date) == 0 || len(s.sp500History.Close) == 0 {
-		log.Printf("WARNING: No S&P500 history available for %v", quoteDate)
-		return 0.0
-	}
-	// Get index of this date (Yahoo dates are returned in UTC).
-	idx := indexOf(getUtcDate(quoteDate), s.sp500History.Date)
-	if idx != -1 {
-		return s.sp500History.Close[idx]
-	} else {
-		y1, m1, d1 := quoteDate.Date()
-		yNow, mNow, dNow := time.Now().Date()
-		if y1 == yNow && m1 == mNow && d1 == dNow {
-			// Likely don't have today's S&P500 quote queried yet, just return the latest quote.
-			return s.sp500History.Close[len(s.sp500History.Close)-1]
-		} else {
-			// Transaction likely occurred on a weekend. Try +/- a few days.
-			for i := 1; i < 4; i++ {
-				idxMinusOne := indexOf(getUtcDate(quoteDate.Add(time.Duration(-24*i)*time.Hour)), s.sp500History.Date)
-				if idxMinusOne != -1 {
-					return s.sp500History.Close[idxMinusOne]
-				}
-				idxPlusOne := indexOf(getUtcDate(quoteDate.Add(time.Duration(24*i)*time.Hour)), s.sp500History.Date)
-				if idxPlusOne != -1 {
-					return s.sp500History.Close[idxPlusOne]
-				}
-			}
-			log.Printf("WARNING: Could not retrieve S&P500 quote for date: %v", quoteDate)
-			return 0.0
-		}
-	}
-}
-
 // Process the financial history data for one stock from the growth stock spreadsheet.
 func (s *Equity) processFinancialHistoryData(data [][]interface{}) {
 	numQs := 0
@@ -261,9 +240,7 @@ func (s *Equity) PreProcess(sheetMgr RevenueDataProvider, stockDataMap *map[stri
 		return
 	}
 	// Lookup if this equity has any stock splits to account for.
-	if val, ok := StockSplits[s.Ticker]; ok {
-		s.transactions = append(s.transactions, val...)
-	}
+	s.transactions = append(s.transactions, corporateActionRegistry.Splits(s.Ticker)...)
 
 	// Order the transactions by date, using anonymous function.
 	sort.Slice(s.transactions, func(i, j int) bool {
@@ -273,10 +250,12 @@ func (s *Equity) PreProcess(sheetMgr RevenueDataProvider, stockDataMap *map[stri
 	s.splitMultiple = 1.0
 	curShares := 0.0
 	for _, txn := range s.transactions {
-		if txn.Action == "Buy" {
+		if txn.Action == "Buy" || txn.Action == "ReinvestedDividend" || isReceivedShares(txn.Action) {
 			curShares += txn.Shares
 		} else if txn.Action == "Sell" {
 			curShares -= txn.Shares
+		} else if txn.Action == "Merger" {
+			curShares = 0.0
 		} else if txn.Action == "Split" {
 			curShares *= txn.Shares
 			s.splitMultiple *= txn.Shares
@@ -313,6 +292,17 @@ func (s *Equity) PreProcess(sheetMgr RevenueDataProvider, stockDataMap *map[stri
 	} else {
 		log.Printf("WARNING: No data returned from Yahoo for ticker %s", s.Ticker)
 	}
+	// Save the sector and industry of stocks sold earlier too, for attribution over past periods. Delisted and
+	// merged stocks have no data, so aren't assigned to one.
+	if s.EquityType == "Stock" && stockData != nil {
+		var ok bool
+		if s.Sector, ok = stockData["sector"].(string); !ok {
+			s.Sector = ""
+		}
+		if s.Industry, ok = stockData["industry"].(string); !ok {
+			s.Industry = ""
+		}
+	}
 	// Do we currently hold this stock (account for minor accounting differences).
 	if curShares > 0.001 {
 		s.CurrentlyHeld = true
@@ -321,12 +311,6 @@ func (s *Equity) PreProcess(sheetMgr RevenueDataProvider, stockDataMap *map[stri
 			var err error
 			var ok bool
 			// Check if Yahoo returned any data for these fields.
-			if s.Sector, ok = stockData["sector"].(string); !ok {
-				s.Sector = ""
-			}
-			if s.Industry, ok = stockData["industry"].(string); !ok {
-				s.Industry = ""
-			}
 			if s.PriceToSalesTtm, ok = stockData["priceToSalesTrailing12Months"].(float64); !ok {
 				s.PriceToSalesTtm = 0.0
 			}
@@ -376,43 +360,51 @@ func (s *Equity) PreProcess(sheetMgr RevenueDataProvider, stockDataMap *map[stri
 func (s *Equity) CalculateTransactionData(txnIdx int, curShares float64) float64 {
 	// Get a reference to the current txn.
 	t := &s.transactions[txnIdx]
-	// For buys, increment number of shares.
-	if t.Action == "Buy" {
+	// For buys (and shares received in a merger or spin-off), increment number of shares.
+	if t.Action == "Buy" || t.Action == "ReinvestedDividend" || isReceivedShares(t.Action) {
 		curShares += t.Shares
-		// Add the txn to the buy queue.
-		s.buyQ = append(s.buyQ, *t)
+		// Add the txn to the buy queue. Reinvested shares start a new lot, with the dividend amount as cost basis.
+		// Remember which txn opened the lot, and include any loss disallowed by an earlier wash sale in its basis.
+		lot := *t
+		lot.id = uint(txnIdx)
+		if (lot.BasisAdjustment != 0 || lot.fee != 0) && lot.Shares > 0 {
+			lot.Price += (lot.BasisAdjustment + lot.fee) / lot.Shares
+		}
+		s.buyQ = append(s.buyQ, lot)
+		if t.Action == "ReinvestedDividend" {
+			s.IncomeReceived += t.Value
+		} else if t.movedValue > 0 {
+			// Shares received in a merger or spin-off are invested at their market value.
+			s.addInvestmentFlow(t.DateTime, -t.movedValue)
+		} else {
+			s.addInvestmentFlow(t.DateTime, -t.Value)
+		}
+	} else if t.Action == "Dividend" || t.Action == "Interest" {
+		s.IncomeReceived += t.Value
+		s.addInvestmentFlow(t.DateTime, t.Value)
+	} else if t.Action == "Fee" {
+		// Fees paid on a trade are already in the lot's basis or the sale's proceeds.
+		if !t.tradeFee {
+			s.FeesPaid += t.Value
+		}
+		s.addInvestmentFlow(t.DateTime, -t.Value)
 	} else if t.Action == "Sell" {
 		curShares -= t.Shares
-		// In the loop below, calculate the realized gain from this sale.
-		remainingShares := t.Shares
-		for remainingShares > 0 {
-			// Make sure we have buys to cover remaining shares in the sell.
-			if len(s.buyQ) > 0 {
-				if s.buyQ[0].Shares > remainingShares {
-					// Remaining sell shares are covered by this buy.
-					s.RealizedGain += (t.Price - s.buyQ[0].Price) * remainingShares
-					s.buyQ[0].Shares -= remainingShares
-					remainingShares = 0
-				} else if s.buyQ[0].Shares == remainingShares {
-					// Shares in this buy equal remaining shares, pop the buy off the queue.
-					s.RealizedGain += (t.Price - s.buyQ[0].Price) * remainingShares
-					remainingShares = 0
-					s.buyQ = s.buyQ[1:]
-				} else if s.buyQ[0].Shares < remainingShares {
-					// This buy is completely covered by sell, pop it.
-					s.RealizedGain += (t.Price - s.buyQ[0].Price) * s.buyQ[0].Shares
-					remainingShares -= s.buyQ[0].Shares
-					s.buyQ = s.buyQ[1:]
-				}
-			} else {
-				// Queue is empty, but apparently have more sold shares to account for.
-				// This is usually due to re-invested dividends.
-				additionalGains := remainingShares * t.Price
-				s.RealizedGain += additionalGains
-				// log.Printf("%s is oversold - Adding remaining shares to realized gain (%f shares, total $%f)\n", t.Ticker, remainingShares, additionalGains)
-				break
-			}
+		s.addInvestmentFlow(t.DateTime, t.Value)
+		// Match the sold shares against open lots, calculating the realized gain from this sale.
+		firstClosedLot := len(s.closedLots)
+		if err := s.sellShares(t); err != nil {
+			t.Error = err.Error()
+			log.Printf("WARNING: %v", err)
 		}
+		// Disallow any loss on this sale if the equity was repurchased within the wash sale window.
+		s.applyWashSaleRule(txnIdx, firstClosedLot)
+	} else if t.Action == "Merger" {
+		// All shares were converted to the acquirer's shares and/or cash.
+		curShares = 0.0
+		s.closeMergedLots(t)
+	} else if t.Action == "SpinOff" {
+		s.reduceSpunOffBasis(t)
 	} else if t.Action == "Split" {
 		curShares *= t.Shares
 		// Apply the split to all txns in the buy queue.
@@ -430,8 +422,11 @@ func (s *Equity) CalculateTransactionData(txnIdx int, curShares float64) float64
 			isNeg = -1.0
 		}
 		// Calculate the return had we bought/sold S&P500 for this transaction.
-		spDateOfTxn := s.GetQuoteOfSP500(t.DateTime)
-		spNow := s.GetQuoteOfSP500(time.Now())
+		spDateOfTxn, okTxn := quoteOnDate(s.sp500History, t.DateTime)
+		spNow, okNow := quoteOnDate(s.sp500History, time.Now())
+		if !okTxn || !okNow {
+			log.Printf("WARNING: Could not retrieve S&P500 quotes for %s transaction on %v", s.Ticker, t.DateTime)
+		}
 
 		if spDateOfTxn > 0 {
 			t.Sp500Return = -((spNow - spDateOfTxn) / spDateOfTxn) * 100.0
@@ -441,6 +436,7 @@ func (s *Equity) CalculateTransactionData(txnIdx int, curShares float64) float64
 			t.TotalReturn = isNeg * ((s.MarketPrice*t.Shares*s.splitMultiple - t.Value) / t.Value) * 100.0
 		}
 		t.ExcessReturn = t.TotalReturn - t.Sp500Return
+		s.calculateBenchmarkReturns(t, isNeg)
 	}
 	// Round down small values to essentially zero.
 	if curShares < 0.001 {
@@ -460,11 +456,26 @@ func (s *Equity) resetCalculatedMetrics() {
 	s.TotalCostBasis = 0.0
 	s.NumShares = 0.0
 	s.RealizedGain = 0.0
+	s.IncomeReceived = 0.0
+	s.FeesPaid = 0.0
 	s.UnrealizedGain = 0.0
 	s.UnrealizedGainPercentage = 0.0
 	s.TotalGain = 0.0
 	s.HoldingDays = 0
 	s.buyQ = make([]Transaction, 0)
+	s.closedLots = make([]ClosedLot, 0)
+	s.investmentFlows = make([]CashFlow, 0)
+	s.MoneyWeightedReturn = 0.0
+	s.Risk = RiskMetrics{}
+	// Clear any wash sale adjustments, which are recalculated as the sales are processed.
+	for i := range s.transactions {
+		s.transactions[i].WashSale = false
+		s.transactions[i].WashSaleDisallowed = 0.0
+		s.transactions[i].BasisAdjustment = 0.0
+		s.transactions[i].washSaleReplacedShares = 0.0
+		s.transactions[i].Error = ""
+	}
+	s.assignTradeFees()
 
 	// Rebuild the multiplier used while processing split transactions. PreProcess
 	// normally initializes it, but recalculation must also be repeatable.
@@ -476,6 +487,29 @@ func (s *Equity) resetCalculatedMetrics() {
 	}
 }
 
+// Assign each fee paid on the date of a buy or sale of this equity to that trade, to be included in the lot's basis
+// or taken from the sale's proceeds.
+func (s *Equity) assignTradeFees() {
+	for i := range s.transactions {
+		s.transactions[i].fee = 0.0
+		s.transactions[i].tradeFee = false
+	}
+	for i := range s.transactions {
+		fee := &s.transactions[i]
+		if fee.Action != "Fee" {
+			continue
+		}
+		for j := range s.transactions {
+			trade := &s.transactions[j]
+			if (trade.Action == "Buy" || trade.Action == "Sell") && datesEqual(trade.DateTime, fee.DateTime) {
+				trade.fee += fee.Value
+				fee.tradeFee = true
+				break
+			}
+		}
+	}
+}
+
 // Calculate various metrics about this equity.
 func (s *Equity) CalculateMetrics(histQuotes data.Quote, sp500Quotes data.Quote) {
 	// Ignore ticker CASH for now, may use this later.
@@ -491,8 +525,9 @@ func (s *Equity) CalculateMetrics(histQuotes data.Quote, sp500Quotes data.Quote)
 	tIdx := 0
 	curShares := 0.0
 
-	// Iterate through each date in the price history since first purchase.
-	if len(s.priceHistory.Date) > 0 && s.MarketPrice != 0.0 {
+	// Iterate through each date in the price history since first purchase. Merged equities have no current price,
+	// but have history up to the merger.
+	if len(s.priceHistory.Date) > 0 && (s.MarketPrice != 0.0 || s.merged) {
 		for dIdx := 0; dIdx < len(s.priceHistory.Date); dIdx++ {
 			// Was there a transaction on this date? (Keep iterating if multiple on this date)
 			for tIdx < len(s.transactions) && datesEqual(s.priceHistory.Date[dIdx], s.transactions[tIdx].DateTime) {
@@ -557,8 +592,22 @@ func (s *Equity) CalculateMetrics(histQuotes data.Quote, sp500Quotes data.Quote)
 			s.PriceToSalesNtm = s.MarketCap / (s.RevenueNextYearEstimate * 1000)
 		}
 	}
-	// Get the total gain.
-	s.TotalGain = s.UnrealizedGain + s.RealizedGain
+	// Get the total gain, including any dividends received net of fees.
+	s.TotalGain = s.UnrealizedGain + s.RealizedGain + s.IncomeReceived - s.FeesPaid
+	// Get the annualized return on the money invested, valuing the remaining shares at the market price.
+	s.MoneyWeightedReturn = CalculateMoneyWeightedReturn(s.investmentFlows, s.MarketValue, time.Now())
+}
+
+// Record money invested in (negative) or returned by (positive) this equity, for money-weighted returns.
+func (s *Equity) addInvestmentFlow(date time.Time, amount float64) {
+	if amount != 0 {
+		s.investmentFlows = append(s.investmentFlows, CashFlow{Date: date, Amount: amount})
+	}
+}
+
+// Get the money invested in (negative) and returned by (positive) this equity, in transaction order.
+func (s *Equity) GetInvestmentCashFlows() []CashFlow {
+	return s.investmentFlows
 }
 
 func (s *Equity) DisplayMetrics() {
@@ -573,6 +622,8 @@ func (s *Equity) DisplayMetrics() {
 	log.Printf("Unrealized Gain: $%f\n", s.UnrealizedGain)
 	log.Printf("Unrealized Gain Percent: %f\n", s.UnrealizedGainPercentage)
 	log.Printf("Realized Gain: $%f\n", s.RealizedGain)
+	log.Printf("Income Received: $%f\n", s.IncomeReceived)
+	log.Printf("Fees Paid: $%f\n", s.FeesPaid)
 	for _, txn := range s.transactions {
 		log.Printf("   -----TXN: %s -----\n", txn.DateTime.Format("2006-01-02"))
 		log.Printf("   Num Shares: %f\n", txn.Shares)
@@ -12,108 +12,20 @@ import (
 	"golang.org/x/exp/maps"
 )
 
-// Define a global map to store the stock split history relevant to our portfolio
-var StockSplits = map[string][]Transaction{
-	"TSLA": {
-		Transaction{
-			Ticker:   "TSLA",
-			DateTime: time.Date(2020, 8, 31, 0, 0, 0, 0, time.Local),
-			Action:   "Split",
-			Shares:   5},
-		Transaction{
-			Ticker:   "TSLA",
-			DateTime: time.Date(2022, 8, 25, 0, 0, 0, 0, time.Local),
-			Action:   "Split",
-			Shares:   3},
-	},
-	"NVDA": {
-		Transaction{
-			Ticker:   "NVDA",
-			DateTime: time.Date(2021, 7, 20, 0, 0, 0, 0, time.Local),
-			Action:   "Split",
-			Shares:   4},
-		Transaction{
-			Ticker:   "NVDA",
-			DateTime: time.Date(2024, 6, 7, 0, 0, 0, 0, time.Local),
-			Action:   "Split",
-			Shares:   10},
-	},
-	"SHOP": {
-		Transaction{
-			Ticker:   "SHOP",
-			DateTime: time.Date(2022, 6, 29, 0, 0, 0, 0, time.Local),
-			Action:   "Split",
-			Shares:   10},
-	},
-	"AMZN": {
-		Transaction{
-			Ticker:   "AMZN",
-			DateTime: time.Date(2022, 6, 6, 0, 0, 0, 0, time.Local),
-			Action:   "Split",
-			Shares:   20},
-	},
-	"GOOG": {
-		Transaction{
-			Ticker:   "GOOG",
-			DateTime: time.Date(2022, 7, 18, 0, 0, 0, 0, time.Local),
-			Action:   "Split",
-			Shares:   20},
-	},
-	"GOOGL": {
-		Transaction{
-			Ticker:   "GOOGL",
-			DateTime: time.Date(2022, 7, 18, 0, 0, 0, 0, time.Local),
-			Action:   "Split",
-			Shares:   20},
-	},
-	"IAU": {
-		Transaction{
-			Ticker:   "IAU",
-			DateTime: time.Date(2021, 5, 24, 0, 0, 0, 0, time.Local),
-			Action:   "Split",
-			Shares:   0.5},
-	},
-	"CELH": {
-		Transaction{
-			Ticker:   "CELH",
-			DateTime: time.Date(2023, 11, 15, 0, 0, 0, 0, time.Local),
-			Action:   "Split",
-			Shares:   3},
-	},
-}
-
-// Define a list of delisted stocks no longer on exchanges so we don't query Yahoo for these.
-var DelistedTickers = map[string][]string{
-	// Went bankrupt in 2022
-	"VYGVF": {"Voyager Digital Ltd."},
-	// Delisted from Nasdaq in July 2023 to OTC as APPH.Q
-	"APPH": {"AppHarvest Inc."},
-	// Delisted from Nasdaq in August 2023, filed for bankrupcy
-	"PTRA": {"Proterra Inc."},
-	// Delisted from Nasdaq in May 2024, failed to comply with listing rules
-	"FFIE": {"Faraday Future Intelligent Electric Inc."},
-	// Delisted from Nasdaq in June 2024, filed for bankrupcy
-	"DMTK": {"Dermtech Inc."},
-	// Bought by AMD
-	"XLNX": {"Xilinx Inc."},
-	// Merged with Gen Digital, delisted in Apr 2025
-	"ML": {"MoneyLion"},
-	// Acquired by CoStar in Feb 2025
-	"MTTR": {"Matterport"},
-	// Delisted mutual fund in 2022
-	"PONDX": {"PIMCO Income Fund Class D"},
-	// This represents cash transactions in our tracker, ignore as a ticker.
-	"CASH": {"Placeholder symbol"},
-}
-
 // Definition of a equity catalogue to house a portfolio of stock/ETF info in a map.
 type EquityCatalogue struct {
-	yFinInterface    *YahooFinanceExtension
+	marketData       MarketDataProvider
 	sp500quotes      data.Quote
 	sheetMgr         *GoogleSheetManager
-	dbClient         *data.MongoDbClient
+	dbClient         data.PriceStore
+	latestQuotes     map[string]time.Time
 	portfolioSummary *PortfolioSummary
 	equityType       string
+	costBasisMethod  string
+	riskFreeRate     float64
+	riskMetrics      RiskMetrics
+	periodicReturns  PeriodicReturns
+	benchmarks       []*Benchmark
 	equities         map[string]*Equity
 	transactions     []Transaction
 	CashFlowByYear   map[int]float64
@@ -121,11 +33,11 @@ type EquityCatalogue struct {
 }
 
 // Constructor for a new EquityCatalogue object, initializing the map.
-func NewEquityCatalogue(equityType string, sheetMgr *GoogleSheetManager, dbClient *data.MongoDbClient, pyScript string) *EquityCatalogue {
+func NewEquityCatalogue(equityType string, sheetMgr *GoogleSheetManager, dbClient data.PriceStore, marketData MarketDataProvider) *EquityCatalogue {
 	var ec EquityCatalogue
 	ec.equityType = equityType
 	// Initialize the interfaces.
-	ec.yFinInterface = NewYahooFinanceExtension(pyScript)
+	ec.marketData = marketData
 	ec.sheetMgr = sheetMgr
 	ec.dbClient = dbClient
 	// Initialize the data structures for this class.
@@ -133,9 +45,57 @@ func NewEquityCatalogue(equityType string, sheetMgr *GoogleSheetManager, dbClien
 	ec.transactions = make([]Transaction, 0)
 	ec.PortfolioHistory = make(map[time.Time]float64)
 	ec.portfolioSummary = NewPortfolioSummary()
+	ec.costBasisMethod = CostBasisFIFO
 	return &ec
 }
 
+// Set the default cost basis method used to match sales against open lots for each equity in this portfolio.
+func (ec *EquityCatalogue) SetCostBasisMethod(method string) error {
+	if err := ValidateCostBasisMethod(method); err != nil {
+		return err
+	}
+	ec.costBasisMethod = method
+	for _, s := range ec.equities {
+		s.costBasisMethod = method
+	}
+	return nil
+}
+
+// Set the annual risk-free rate (e.g. 0.04 for 4%) used to calculate Sharpe and Sortino ratios and alpha.
+func (ec *EquityCatalogue) SetRiskFreeRate(rate float64) {
+	ec.riskFreeRate = rate
+}
+
+// Set the benchmarks to compare the returns of this portfolio and its transactions against. The catalogue keeps its
+// own copies, as it builds their histories while others may be reading the given benchmarks.
+func (ec *EquityCatalogue) SetBenchmarks(benchmarks []*Benchmark) {
+	ec.benchmarks = make([]*Benchmark, 0, len(benchmarks))
+	for _, b := range benchmarks {
+		benchmark := *b
+		ec.benchmarks = append(ec.benchmarks, &benchmark)
+	}
+}
+
+// Get this portfolio's benchmarks, with the histories built when it was last calculated.
+func (ec *EquityCatalogue) GetBenchmarks() []*Benchmark {
+	return ec.benchmarks
+}
+
+// Get the risk metrics of this portfolio's holdings, calculated from their daily value history.
+func (ec *EquityCatalogue) GetRiskMetrics() RiskMetrics {
+	return ec.riskMetrics
+}
+
+// Helper function to read an optional cell from a row of sheet data (the Sheets API omits trailing empty cells).
+func optionalCell(row []interface{}, idx int) string {
+	if idx < len(row) {
+		if val, ok := row[idx].(string); ok {
+			return strings.TrimSpace(val)
+		}
+	}
+	return ""
+}
+
 // Return the full portfolio summary followed by the stock-only portfolio summary.
 func (ec *EquityCatalogue) GetPortfolioSummary() *PortfolioSummary {
 	return ec.portfolioSummary
@@ -155,6 +115,15 @@ func (ec *EquityCatalogue) GetTransactionList() []Transaction {
 	return txns
 }
 
+// Get the lots closed by sales of each equity, used for realized gain reporting.
+func (ec *EquityCatalogue) GetClosedLots() []ClosedLot {
+	var lots []ClosedLot
+	for _, s := range ec.equities {
+		lots = append(lots, s.GetClosedLots()...)
+	}
+	return lots
+}
+
 func (ec *EquityCatalogue) GetSp500() data.Quote {
 	return ec.sp500quotes
 }
@@ -179,6 +148,15 @@ func (ec *EquityCatalogue) ProcessImport(txnData [][]interface{}) {
 			// Create a new transaction with this row of data.
 			txn := NewTransaction(row[0].(string), row[1].(string), row[2].(string), row[3].(string), row[4].(string))
 			if txn != nil {
+				// Track transactions under a renamed ticker's current symbol.
+				txn.Ticker = corporateActionRegistry.CurrentTicker(txn.Ticker)
+				// Optional columns: a lot ID (names a buy lot, or the lots to sell), and a cost basis method override.
+				txn.LotId = optionalCell(row, 7)
+				if txn.CostBasisMethod = optionalCell(row, 8); txn.CostBasisMethod != "" {
+					if err := ValidateCostBasisMethod(txn.CostBasisMethod); err != nil {
+						log.Fatalf("Unable to parse cost basis method field from transaction: %v", err)
+					}
+				}
 				// Add it to the total txns list.
 				ec.transactions = append(ec.transactions, *txn)
 				// Check if we've seen the current ticker yet.
@@ -188,6 +166,7 @@ func (ec *EquityCatalogue) ProcessImport(txnData [][]interface{}) {
 				} else {
 					// Create a new Equity to track transactions for it, then append.
 					if sec, err := NewEquity(txn.Ticker, row[5].(string)); err == nil {
+						sec.costBasisMethod = ec.costBasisMethod
 						sec.transactions = append(sec.transactions, *txn)
 						ec.equities[txn.Ticker] = sec
 					}
@@ -197,19 +176,24 @@ func (ec *EquityCatalogue) ProcessImport(txnData [][]interface{}) {
 	}
 }
 
-// Retrieves data from Yahoo for the given ticker, and stores the data in the DB.
+// Retrieves data from the market data provider for the given ticker, and stores the data in the DB.
 func (ec *EquityCatalogue) RetrieveAndStoreStockData(ticker string, startDate string, endDate string) {
 	queryTicker := ticker
 	if ec.equityType == "crypto" {
 		queryTicker = queryTicker + "-USD"
 	}
+	ec.retrieveAndStoreHistory(ticker, queryTicker, startDate, endDate)
+}
+
+// Retrieves data from the market data provider under the query ticker, and stores the data in the DB under the ticker.
+func (ec *EquityCatalogue) retrieveAndStoreHistory(ticker string, queryTicker string, startDate string, endDate string) {
 	log.Printf("Querying %s data from Yahoo: %s ---> %s", queryTicker, startDate, endDate)
-	quote, err := ec.yFinInterface.GetHistoricalData(queryTicker, startDate, endDate)
+	quote, err := ec.marketData.GetHistoricalData(queryTicker, startDate, endDate)
 	if err != nil {
 		log.Printf("WARNING: Couldn't get ticker (%s) data from Yahoo: %s", queryTicker, err)
 		return
 	}
-	quote.Symbol = strings.TrimSuffix(quote.Symbol, "-USD")
+	quote.Symbol = ticker
 	ec.dbClient.StoreTickerData(*quote)
 }
 
@@ -217,8 +201,7 @@ func (ec *EquityCatalogue) RetrieveAndStoreStockData(ticker string, startDate st
 func (ec *EquityCatalogue) RefreshStockHistory(txns *[]Transaction, currentlyOwned bool) {
 	// Does the ticker exist in the DB?
 	ticker := (*txns)[0].Ticker
-	if ec.dbClient.TickerExists(ticker) {
-		latestDate := ec.dbClient.GetLatestQuote(ticker)
+	if latestDate, ok := ec.latestQuoteDate(ticker); ok {
 		// Do we currently own this equity?
 		if currentlyOwned {
 			// Are we up to date on the quotes? More than 3 days have passed?
@@ -238,6 +221,19 @@ func (ec *EquityCatalogue) RefreshStockHistory(txns *[]Transaction, currentlyOwn
 	}
 }
 
+// Get the date of the latest quote stored for a ticker, and whether it has any. Uses the dates loaded for all tickers
+// at the start of Calculate, if available.
+func (ec *EquityCatalogue) latestQuoteDate(ticker string) (time.Time, bool) {
+	if ec.latestQuotes != nil {
+		latest, ok := ec.latestQuotes[ticker]
+		return latest, ok
+	}
+	if !ec.dbClient.TickerExists(ticker) {
+		return time.Time{}, false
+	}
+	return ec.dbClient.GetLatestQuote(ticker), true
+}
+
 // Add an individual's equity history to the total portfolio value history.
 func (ec *EquityCatalogue) AccumulateValueHistory(stockHistory map[int64]float64) {
 	// Iterate through each date for this equity and add to the total.
@@ -256,17 +252,28 @@ func (ec *EquityCatalogue) CalculateCashBalanceHistory() {
 		ec.equities["CASH"] = cash
 	}
 	curCashAmount := 0.0
+	cash.IncomeReceived = 0.0
+	cash.FeesPaid = 0.0
 	ec.CashFlowByYear = make(map[int]float64)
 	// Order the transactions by date, using anonymous function.
 	sort.Slice(ec.transactions, func(i, j int) bool {
 		return ec.transactions[i].DateTime.Before(ec.transactions[j].DateTime)
 	})
 	for _, txn := range ec.transactions {
-		if txn.Action == "Deposit" || txn.Action == "Sell" {
+		// Reinvested dividends are received and spent on shares at once, so leave the cash balance unchanged.
+		if txn.Action == "Deposit" || txn.Action == "Sell" || txn.Action == "Dividend" || txn.Action == "Interest" || txn.Action == "Merger" {
 			curCashAmount += txn.Value
-		} else if txn.Action == "Withdraw" || txn.Action == "Buy" {
+		} else if txn.Action == "Withdraw" || txn.Action == "Buy" || txn.Action == "Fee" {
 			curCashAmount -= txn.Value
 		}
+		// Track income and fees on the cash balance itself (e.g. interest), other equities track their own.
+		if txn.Ticker == "CASH" {
+			if txn.Action == "Dividend" || txn.Action == "Interest" {
+				cash.IncomeReceived += txn.Value
+			} else if txn.Action == "Fee" {
+				cash.FeesPaid += txn.Value
+			}
+		}
 		cash.ValueHistory[txn.DateTime.Unix()] = curCashAmount
 		// Keep track of portfolio cash flow by year.
 		if txn.Action == "Deposit" {
@@ -295,9 +302,14 @@ func (ec *EquityCatalogue) CalculatePortfolioSummaryMetrics() {
 			// For cash, just track the current balance in the summary.
 			ec.portfolioSummary.TotalMarketValue += s.MarketValue
 		}
+		ec.portfolioSummary.TotalIncome += s.IncomeReceived - s.FeesPaid
 	}
 
 	ec.portfolioSummary.CalculateHistoricalPerformance(ec.PortfolioHistory, ec.CashFlowByYear)
+	ec.portfolioSummary.TimeWeightedReturns = CalculateTimeWeightedReturns(ec.GetValueHistory(), ec.GetExternalCashFlows())
+	investmentFlows, investedValue := ec.GetInvestmentCashFlows()
+	ec.portfolioSummary.MoneyWeightedReturn = CalculateMoneyWeightedReturn(investmentFlows, investedValue, time.Now())
+	ec.portfolioSummary.Benchmarks = CompareBenchmarks(ec.benchmarks, ec.GetValueHistory(), ec.portfolioSummary.TimeWeightedReturns)
 	// Store the last updated time, and percentage gain.
 	ec.portfolioSummary.LastUpdated = time.Now()
 	if ec.portfolioSummary.TotalCostBasis > 0.001 {
@@ -305,33 +317,94 @@ func (ec *EquityCatalogue) CalculatePortfolioSummaryMetrics() {
 	}
 }
 
-// Kicks off async functions in go-routines to calculate metrics for each equity
-func (ec *EquityCatalogue) Calculate() {
+// Get the daily value history of the portfolio, including the cash balance at the end of each day.
+func (ec *EquityCatalogue) GetValueHistory() map[time.Time]float64 {
+	valueHistory := make(map[time.Time]float64)
+	var cashTimes []int64
+	if cash, ok := ec.equities["CASH"]; ok {
+		cashTimes = maps.Keys(cash.ValueHistory)
+		sort.Slice(cashTimes, func(i, j int) bool { return cashTimes[i] < cashTimes[j] })
+	}
+	cIdx := 0
+	cashBalance := 0.0
+	for _, date := range sortedDates(ec.PortfolioHistory) {
+		// Apply the cash balance after each transaction through the end of this day.
+		for cIdx < len(cashTimes) && cashTimes[cIdx] < date.Add(24*time.Hour).Unix() {
+			cashBalance = ec.equities["CASH"].ValueHistory[cashTimes[cIdx]]
+			cIdx++
+		}
+		valueHistory[date] = ec.PortfolioHistory[date] + cashBalance
+	}
+	return valueHistory
+}
+
+// Get the deposits into and withdrawals from the portfolio, in date order.
+func (ec *EquityCatalogue) GetExternalCashFlows() []CashFlow {
+	flows := make([]CashFlow, 0)
+	for _, txn := range ec.transactions {
+		if txn.Action == "Deposit" {
+			flows = append(flows, CashFlow{Date: txn.DateTime, Amount: txn.Value})
+		} else if txn.Action == "Withdraw" {
+			flows = append(flows, CashFlow{Date: txn.DateTime, Amount: -txn.Value})
+		}
+	}
+	sortCashFlows(flows)
+	return flows
+}
 
-	// Grab the historical S&P 500 data to compare against (2015 to present).
-	// Define a dummy SPY transaction to pass in, the date is what the function requires.
-	ec.RefreshStockHistory(&[]Transaction{*NewTransaction("1/1/2015", "SPY", "Buy", "1", "100.0")}, true)
-	ec.sp500quotes = ec.dbClient.GetTickerData("SPY")
+// Get the money invested in (negative) and returned by (positive) each equity, along with the current market value
+// of the equities, for money-weighted returns.
+func (ec *EquityCatalogue) GetInvestmentCashFlows() ([]CashFlow, float64) {
+	flows := make([]CashFlow, 0)
+	marketValue := 0.0
+	for _, s := range ec.equities {
+		if s.Ticker != "CASH" {
+			flows = append(flows, s.GetInvestmentCashFlows()...)
+			marketValue += s.MarketValue
+		}
+	}
+	sortCashFlows(flows)
+	return flows, marketValue
+}
 
-	// Get the tickers for all equities we've ever owned in comma-separated list.
-	tickers := make([]string, 0, len(ec.equities))
+// Queries the market data provider for quote and fundamental data on each equity, keyed by the provider's ticker.
+func (ec *EquityCatalogue) RetrieveQuoteData() map[string]interface{} {
 	var allStocksData map[string]interface{} = make(map[string]interface{})
 	for t := range ec.equities {
-		var ticker string
 		// Don't include any delisted equities.
-		if _, ok := DelistedTickers[t]; !ok {
+		if !skipMarketData(t) {
+			ticker := t
 			if ec.equityType == "crypto" {
 				ticker = t + "-USD"
-			} else {
-				ticker = t
 			}
-			tickers = append(tickers, ticker)
-			// Use Python yFinance module to query data for each ticker.
-			temp := ec.yFinInterface.GetTickerData(ticker)
-			allStocksData[ticker] = (*temp)[ticker]
+			// Query the provider for each ticker, skipping any it has no data for.
+			if temp := ec.marketData.GetTickerData(ticker); temp != nil {
+				if val, ok := (*temp)[ticker]; ok {
+					allStocksData[ticker] = val
+				}
+			}
 		}
 	}
-	log.Printf("Queried Yahoo finance for %d equities...\n", len(tickers))
+	log.Printf("Queried market data for %d equities...\n", len(allStocksData))
+	return allStocksData
+}
+
+// Kicks off async functions in go-routines to calculate metrics for each equity
+func (ec *EquityCatalogue) Calculate() {
+
+	// Check how up-to-date the stored price history of every ticker is, in one query.
+	ec.latestQuotes = ec.dbClient.GetLatestQuoteDates()
+
+	// Grab the historical S&P 500 and benchmark data to compare against (2015 to present).
+	ec.RetrieveBenchmarkHistories()
+
+	// Move shares between tickers for any mergers and spin-offs, before querying market data.
+	ec.ApplyShareConversions()
+	// Reload, to include the benchmarks and new tickers just refreshed.
+	ec.latestQuotes = ec.dbClient.GetLatestQuoteDates()
+
+	// Query quote and fundamental data for all equities we've ever owned.
+	allStocksData := ec.RetrieveQuoteData()
 
 	// Setup a wait group.
 	var waitGroup sync.WaitGroup
@@ -343,13 +416,17 @@ func (ec *EquityCatalogue) Calculate() {
 	for _, s := range ec.equities {
 		// Launch a new goroutine for this equity.
 		go func(s *Equity) {
-			if _, ok := DelistedTickers[s.Ticker]; !ok {
+			if !skipMarketData(s.Ticker) || s.merged {
 				s.PreProcess(ec.sheetMgr, &allStocksData)
 				// Make sure the stock's history data is up-to-date.
 				ec.RefreshStockHistory(&s.transactions, s.CurrentlyHeld)
 			}
 			// Pass SP500 quotes to this function to use when calculating transaction level metrics.
+			s.benchmarks = ec.benchmarks
 			s.CalculateMetrics(ec.dbClient.GetTickerData(s.Ticker), ec.sp500quotes)
+			if s.Ticker != "CASH" {
+				s.CalculateRiskMetrics(ec.riskFreeRate)
+			}
 			waitGroup.Done()
 		}(s)
 	}
@@ -362,6 +439,8 @@ func (ec *EquityCatalogue) Calculate() {
 
 	// Calculate total invested market value and other summary metrics across all equities.
 	ec.CalculatePortfolioSummaryMetrics()
+	ec.riskMetrics = CalculateRiskMetrics(CalculateDailyReturns(ec.PortfolioHistory, ec.GetHoldingsCashFlows()), ec.sp500quotes, ec.riskFreeRate)
+	ec.periodicReturns = CalculatePeriodicReturns(ec.PortfolioHistory, ec.GetHoldingsCashFlows())
 
 	log.Println("---------------------------------")
 	log.Printf("Total Market Value: $%f", ec.portfolioSummary.TotalMarketValue)
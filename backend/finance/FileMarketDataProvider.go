@@ -0,0 +1,363 @@
+package finance
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+// Header row of the daily history fixture files (same columns as a yfinance CSV export).
+var historyCsvHeader = []string{"Date", "Open", "High", "Low", "Close", "Volume"}
+
+// A market data provider that serves quotes, fundamentals and daily history from a directory of fixture files,
+// for tests and offline runs. The directory layout is:
+//
+//	<dir>/info/<TICKER>.json   - yfinance-style info dictionary (currentPrice, previousClose, sector, etc)
+//	<dir>/history/<TICKER>.csv - daily bars with columns Date,Open,High,Low,Close,Volume
+//	<dir>/splits/<TICKER>.csv  - stock splits with columns Date,Ratio (optional)
+type FileMarketDataProvider struct {
+	directory string
+}
+
+// Constructor for a new FileMarketDataProvider.
+func NewFileMarketDataProvider(directory string) *FileMarketDataProvider {
+	var p FileMarketDataProvider
+	p.directory = directory
+	return &p
+}
+
+func (p *FileMarketDataProvider) infoFile(ticker string) string {
+	return filepath.Join(p.directory, "info", ticker+".json")
+}
+
+func (p *FileMarketDataProvider) historyFile(ticker string) string {
+	return filepath.Join(p.directory, "history", ticker+".csv")
+}
+
+func (p *FileMarketDataProvider) splitsFile(ticker string) string {
+	return filepath.Join(p.directory, "splits", ticker+".csv")
+}
+
+// Read the info fixture for each of the given tickers (accepts single ticker or comma-separated list of tickers).
+func (p *FileMarketDataProvider) GetTickerData(tickers string) *map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, ticker := range strings.Split(tickers, ",") {
+		ticker = strings.TrimSpace(ticker)
+		if ticker == "" {
+			continue
+		}
+		contents, err := os.ReadFile(p.infoFile(ticker))
+		if err != nil {
+			log.Printf("WARNING: No market data fixture for ticker %s: %v", ticker, err)
+			continue
+		}
+		var info map[string]interface{}
+		if err = json.Unmarshal(contents, &info); err != nil {
+			log.Printf("Error unmarshaling market data fixture for %s: %v", ticker, err)
+			continue
+		}
+		result[ticker] = info
+	}
+	return &result
+}
+
+// Read the daily history fixture for a ticker, keeping bars between the given dates (YYYY-MM-DD, end date exclusive).
+func (p *FileMarketDataProvider) GetHistoricalData(ticker string, startDate string, endDate string) (*data.Quote, error) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p.historyFile(ticker))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	quote, err := readHistoryCsv(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse history fixture for %s: %v", ticker, err)
+	}
+	// Filter the bars to the requested date range.
+	var filtered data.Quote
+	filtered.Symbol = ticker
+	for i, date := range quote.Date {
+		if !date.Before(start) && date.Before(end) {
+			filtered.Date = append(filtered.Date, date)
+			filtered.Open = append(filtered.Open, quote.Open[i])
+			filtered.High = append(filtered.High, quote.High[i])
+			filtered.Low = append(filtered.Low, quote.Low[i])
+			filtered.Close = append(filtered.Close, quote.Close[i])
+			filtered.Volume = append(filtered.Volume, quote.Volume[i])
+		}
+	}
+	return &filtered, nil
+}
+
+// Read the split fixture for a ticker. A ticker without a split fixture has no splits.
+func (p *FileMarketDataProvider) GetSplitHistory(ticker string) ([]data.CorporateAction, error) {
+	file, err := os.Open(p.splitsFile(ticker))
+	if errors.Is(err, os.ErrNotExist) {
+		return []data.CorporateAction{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	actions, err := readSplitsCsv(ticker, file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse split fixture for %s: %v", ticker, err)
+	}
+	return actions, nil
+}
+
+// Parse stock splits from a CSV with columns Date,Ratio.
+func readSplitsCsv(ticker string, reader io.Reader) ([]data.CorporateAction, error) {
+	rows, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	actions := make([]data.CorporateAction, 0)
+	for idx, row := range rows {
+		if idx == 0 && len(row) > 0 && row[0] == "Date" {
+			continue
+		}
+		if len(row) < 2 {
+			return nil, fmt.Errorf("row %d has %d columns, expected 2", idx+1, len(row))
+		}
+		dateStr := strings.TrimSpace(row[0])
+		if len(dateStr) < 10 {
+			return nil, errors.New("invalid date " + dateStr)
+		}
+		date, err := time.Parse("2006-01-02", dateStr[:10])
+		if err != nil {
+			return nil, err
+		}
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, data.CorporateAction{Ticker: ticker, Type: data.CorporateActionSplit, Date: date, Ratio: ratio})
+	}
+	return actions, nil
+}
+
+// Write stock splits as a CSV with columns Date,Ratio.
+func writeSplitsCsv(writer io.Writer, actions []data.CorporateAction) error {
+	w := csv.NewWriter(writer)
+	if err := w.Write([]string{"Date", "Ratio"}); err != nil {
+		return err
+	}
+	for _, action := range actions {
+		if err := w.Write([]string{action.Date.Format("2006-01-02"), strconv.FormatFloat(action.Ratio, 'f', -1, 64)}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Parse daily bars from a history CSV. Only the date portion of the Date column is used, so yfinance
+// exports with a time and UTC offset (e.g. 2024-01-02 00:00:00-05:00) are also accepted.
+func readHistoryCsv(reader io.Reader) (*data.Quote, error) {
+	rows, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("missing header row")
+	}
+	// Map each expected column to its index in the header.
+	columns := make(map[string]int)
+	for idx, name := range rows[0] {
+		columns[strings.TrimSpace(name)] = idx
+	}
+	for _, name := range historyCsvHeader {
+		if _, ok := columns[name]; !ok {
+			return nil, errors.New("missing column " + name)
+		}
+	}
+	var quote data.Quote
+	for _, row := range rows[1:] {
+		dateStr := strings.TrimSpace(row[columns["Date"]])
+		if len(dateStr) < 10 {
+			return nil, errors.New("invalid date " + dateStr)
+		}
+		date, err := time.Parse("2006-01-02", dateStr[:10])
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]float64, 0, len(historyCsvHeader)-1)
+		for _, name := range historyCsvHeader[1:] {
+			val, err := strconv.ParseFloat(strings.TrimSpace(row[columns[name]]), 64)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, val)
+		}
+		quote.Date = append(quote.Date, date)
+		quote.Open = append(quote.Open, vals[0])
+		quote.High = append(quote.High, vals[1])
+		quote.Low = append(quote.Low, vals[2])
+		quote.Close = append(quote.Close, vals[3])
+		quote.Volume = append(quote.Volume, vals[4])
+	}
+	return &quote, nil
+}
+
+// Write daily bars to a history CSV, in the layout read by readHistoryCsv.
+func writeHistoryCsv(writer io.Writer, quote *data.Quote) error {
+	w := csv.NewWriter(writer)
+	if err := w.Write(historyCsvHeader); err != nil {
+		return err
+	}
+	format := func(vals []float64, idx int) string {
+		if idx < len(vals) {
+			return strconv.FormatFloat(vals[idx], 'f', -1, 64)
+		}
+		return "0"
+	}
+	for i, date := range quote.Date {
+		row := []string{date.Format("2006-01-02"), format(quote.Open, i), format(quote.High, i),
+			format(quote.Low, i), format(quote.Close, i), format(quote.Volume, i)}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// A market data provider that passes queries through to another provider, and saves every response as a fixture
+// file for the FileMarketDataProvider. Used to freeze a snapshot of prices to reproduce an issue offline later.
+type RecordingMarketDataProvider struct {
+	provider MarketDataProvider
+	fixtures *FileMarketDataProvider
+}
+
+// Constructor for a new RecordingMarketDataProvider.
+func NewRecordingMarketDataProvider(provider MarketDataProvider, directory string) *RecordingMarketDataProvider {
+	var r RecordingMarketDataProvider
+	r.provider = provider
+	r.fixtures = NewFileMarketDataProvider(directory)
+	return &r
+}
+
+// Query the wrapped provider, and save each returned info dictionary to the fixture directory.
+func (r *RecordingMarketDataProvider) GetTickerData(tickers string) *map[string]interface{} {
+	result := r.provider.GetTickerData(tickers)
+	if result == nil {
+		return result
+	}
+	for ticker, info := range *result {
+		contents, err := json.MarshalIndent(info, "", "    ")
+		if err == nil {
+			err = writeFixtureFile(r.fixtures.infoFile(ticker), contents)
+		}
+		if err != nil {
+			log.Printf("WARNING: Unable to record market data fixture for %s: %v", ticker, err)
+		}
+	}
+	return result
+}
+
+// Query the wrapped provider, and merge the returned bars into the ticker's history fixture.
+func (r *RecordingMarketDataProvider) GetHistoricalData(ticker string, startDate string, endDate string) (*data.Quote, error) {
+	quote, err := r.provider.GetHistoricalData(ticker, startDate, endDate)
+	if err != nil {
+		return quote, err
+	}
+	// Combine with any bars recorded previously, since history is typically fetched incrementally.
+	merged := &data.Quote{Symbol: ticker}
+	if file, openErr := os.Open(r.fixtures.historyFile(ticker)); openErr == nil {
+		if existing, readErr := readHistoryCsv(file); readErr == nil {
+			merged = existing
+		}
+		file.Close()
+	}
+	merged = mergeQuotes(merged, quote)
+	var contents strings.Builder
+	if err := writeHistoryCsv(&contents, merged); err == nil {
+		err = writeFixtureFile(r.fixtures.historyFile(ticker), []byte(contents.String()))
+		if err != nil {
+			log.Printf("WARNING: Unable to record history fixture for %s: %v", ticker, err)
+		}
+	}
+	return quote, nil
+}
+
+// Query the wrapped provider for split history (if supported), and save the splits to the ticker's split fixture.
+func (r *RecordingMarketDataProvider) GetSplitHistory(ticker string) ([]data.CorporateAction, error) {
+	splitProvider, ok := r.provider.(SplitHistoryProvider)
+	if !ok {
+		return []data.CorporateAction{}, nil
+	}
+	actions, err := splitProvider.GetSplitHistory(ticker)
+	if err != nil {
+		return actions, err
+	}
+	var contents strings.Builder
+	if err := writeSplitsCsv(&contents, actions); err == nil {
+		err = writeFixtureFile(r.fixtures.splitsFile(ticker), []byte(contents.String()))
+		if err != nil {
+			log.Printf("WARNING: Unable to record split fixture for %s: %v", ticker, err)
+		}
+	}
+	return actions, nil
+}
+
+// Helper function to combine two sets of daily bars, ordered by date. Bars in the newer quote replace existing ones.
+func mergeQuotes(existing *data.Quote, newer *data.Quote) *data.Quote {
+	byDate := make(map[time.Time]int)
+	merged := &data.Quote{Symbol: newer.Symbol}
+	appendBar := func(q *data.Quote, i int) {
+		vals := []float64{valueOf(q.Open, i), valueOf(q.High, i), valueOf(q.Low, i), q.Close[i], valueOf(q.Volume, i)}
+		if idx, ok := byDate[q.Date[i]]; ok {
+			merged.Open[idx], merged.High[idx], merged.Low[idx], merged.Close[idx], merged.Volume[idx] = vals[0], vals[1], vals[2], vals[3], vals[4]
+			return
+		}
+		byDate[q.Date[i]] = len(merged.Date)
+		merged.Date = append(merged.Date, q.Date[i])
+		merged.Open = append(merged.Open, vals[0])
+		merged.High = append(merged.High, vals[1])
+		merged.Low = append(merged.Low, vals[2])
+		merged.Close = append(merged.Close, vals[3])
+		merged.Volume = append(merged.Volume, vals[4])
+	}
+	for _, q := range []*data.Quote{existing, newer} {
+		for i := range q.Date {
+			if i < len(q.Close) {
+				appendBar(q, i)
+			}
+		}
+	}
+	merged.SortByDate()
+	return merged
+}
+
+// Helper function to read a value from an optional bar array.
+func valueOf(arr []float64, idx int) float64 {
+	if idx < len(arr) {
+		return arr[idx]
+	}
+	return 0.0
+}
+
+// Write a fixture file, creating its directory if necessary.
+func writeFixtureFile(fileName string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, contents, 0644)
+}
@@ -0,0 +1,47 @@
+package finance
+
+import (
+	"errors"
+
+	"github.com/kfwalther/Polly/backend/config"
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+// MarketDataProvider retrieves quotes, fundamentals and historical price bars for equities.
+type MarketDataProvider interface {
+	// Query quote and fundamental data for the given tickers (accepts single ticker or comma-separated list of tickers).
+	// The returned map is keyed by ticker, and each entry follows the yfinance "info" layout (currentPrice, sector, etc).
+	GetTickerData(tickers string) *map[string]interface{}
+	// Query daily price history for a ticker between the given dates (YYYY-MM-DD, end date exclusive).
+	GetHistoricalData(ticker string, startDate string, endDate string) (*data.Quote, error)
+}
+
+// The helper script called by the python market data provider, when none is configured.
+const DefaultYahooFinanceScript = "yahooFinanceHelper.py"
+
+// Create the market data provider selected in the server configuration. The Python yfinance bridge is used by default.
+func NewMarketDataProvider(cfg *config.Configuration) (MarketDataProvider, error) {
+	var provider MarketDataProvider
+	switch cfg.MarketDataProvider {
+	case "", "python":
+		script := cfg.YahooFinanceScript
+		if script == "" {
+			script = DefaultYahooFinanceScript
+		}
+		provider = NewYahooFinanceExtension(script)
+	case "yahoo":
+		provider = NewYahooFinanceClient()
+	case "file":
+		if cfg.MarketDataDirectory == "" {
+			return nil, errors.New("No MarketDataDirectory configured for the file market data provider")
+		}
+		provider = NewFileMarketDataProvider(cfg.MarketDataDirectory)
+	default:
+		return nil, errors.New("Unknown market data provider (" + cfg.MarketDataProvider + ")")
+	}
+	// Optionally save a snapshot of every response, to replay later with the file provider.
+	if cfg.MarketDataRecordDirectory != "" {
+		provider = NewRecordingMarketDataProvider(provider, cfg.MarketDataRecordDirectory)
+	}
+	return provider, nil
+}
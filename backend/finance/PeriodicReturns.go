@@ -0,0 +1,84 @@
+package finance
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// The lengths (in years) of the rolling return windows.
+var RollingReturnYears = []int{1, 3, 5}
+
+// Definition of the annualized return (%) over the window ending on a date.
+type RollingReturn struct {
+	Date   time.Time `json:"date"`
+	Return float64   `json:"return"`
+}
+
+// Definition of the returns (%) of a portfolio by month (year to month number), and its rolling annualized returns
+// (window length in years to daily series), all excluding the effect of cash flows.
+type PeriodicReturns struct {
+	Monthly map[int]map[int]float64 `json:"monthly"`
+	Rolling map[int][]RollingReturn `json:"rolling"`
+}
+
+// Calculate the monthly and rolling returns of a portfolio from its daily value history and cash flows.
+func CalculatePeriodicReturns(valueHistory map[time.Time]float64, cashFlows []CashFlow) PeriodicReturns {
+	var pr PeriodicReturns
+	pr.Monthly = make(map[int]map[int]float64)
+	pr.Rolling = make(map[int][]RollingReturn)
+	returns := CalculateDailyReturns(valueHistory, cashFlows)
+	if len(returns) == 0 {
+		return pr
+	}
+	// Link the daily returns into a growth index, and by month.
+	dates := []time.Time{returns[0].PrevDate}
+	index := []float64{1.0}
+	for _, daily := range returns {
+		year, month := daily.Date.Year(), int(daily.Date.Month())
+		if _, ok := pr.Monthly[year]; !ok {
+			pr.Monthly[year] = make(map[int]float64)
+		}
+		if _, ok := pr.Monthly[year][month]; !ok {
+			pr.Monthly[year][month] = 1.0
+		}
+		pr.Monthly[year][month] *= 1 + daily.Return
+		dates = append(dates, daily.Date)
+		index = append(index, index[len(index)-1]*(1+daily.Return))
+	}
+	for year := range pr.Monthly {
+		for month, growth := range pr.Monthly[year] {
+			pr.Monthly[year][month] = (growth - 1) * 100.0
+		}
+	}
+	for _, years := range RollingReturnYears {
+		pr.Rolling[years] = calculateRollingReturns(dates, index, years)
+	}
+	return pr
+}
+
+// Calculate the annualized return over each window of the given years, from a growth index. Windows starting on a
+// date without a value (e.g. a weekend) start from the latest value before it.
+func calculateRollingReturns(dates []time.Time, index []float64, years int) []RollingReturn {
+	rolling := make([]RollingReturn, 0)
+	for idx, date := range dates {
+		start := date.AddDate(-years, 0, 0)
+		if start.Before(dates[0]) {
+			continue
+		}
+		startIdx := sort.Search(len(dates), func(i int) bool {
+			return dates[i].After(start)
+		}) - 1
+		if index[startIdx] <= 0 || index[idx] <= 0 {
+			continue
+		}
+		annualized := math.Pow(index[idx]/index[startIdx], 1/float64(years)) - 1
+		rolling = append(rolling, RollingReturn{Date: date, Return: annualized * 100.0})
+	}
+	return rolling
+}
+
+// Get the monthly and rolling returns of this portfolio's holdings, calculated from their daily value history.
+func (ec *EquityCatalogue) GetPeriodicReturns() PeriodicReturns {
+	return ec.periodicReturns
+}
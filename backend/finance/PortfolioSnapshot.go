@@ -0,0 +1,39 @@
+package finance
+
+import (
+	"sort"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+// Build the end-of-day snapshot of this portfolio's holdings, for the latest date of its value history (or today, if
+// it has none). Call after Calculate.
+func (ec *EquityCatalogue) GetSnapshot() data.Snapshot {
+	var snapshot data.Snapshot
+	snapshot.EquityType = ec.equityType
+	snapshot.Date = getUtcDate(time.Now())
+	if dates := sortedDates(ec.PortfolioHistory); len(dates) > 0 {
+		snapshot.Date = dates[len(dates)-1]
+	}
+	snapshot.MarketValue = ec.portfolioSummary.TotalMarketValue
+	snapshot.CostBasis = ec.portfolioSummary.TotalCostBasis
+	snapshot.Holdings = make([]data.SnapshotHolding, 0)
+	for _, s := range ec.equities {
+		if s.Ticker == "CASH" {
+			snapshot.Cash = s.MarketValue
+		} else if s.CurrentlyHeld {
+			snapshot.Holdings = append(snapshot.Holdings, data.SnapshotHolding{
+				Ticker:      s.Ticker,
+				Shares:      s.NumShares,
+				Price:       s.MarketPrice,
+				MarketValue: s.MarketValue,
+				CostBasis:   s.TotalCostBasis,
+			})
+		}
+	}
+	sort.Slice(snapshot.Holdings, func(i, j int) bool {
+		return snapshot.Holdings[i].Ticker < snapshot.Holdings[j].Ticker
+	})
+	return snapshot
+}
@@ -12,9 +12,16 @@ type PortfolioSummary struct {
 	TotalCostBasis    float64         `json:"totalCostBasis"`
 	PercentageGain    float64         `json:"percentageGain"`
 	DailyGain         float64         `json:"dailyGain"`
+	TotalIncome       float64         `json:"totalIncome"`
 	LastUpdated       time.Time       `json:"lastUpdated"`
 	MarketValueJan1   float64         `json:"marketValueJan1"`
 	AnnualPerformance map[int]float64 `json:"annualPerformance"`
+	// Daily-linked returns, unaffected by the timing of deposits and withdrawals.
+	TimeWeightedReturns TimeWeightedReturns `json:"timeWeightedReturns"`
+	// Annualized return (XIRR) on the money invested in the equities, valued at their current market value.
+	MoneyWeightedReturn float64 `json:"moneyWeightedReturn"`
+	// Returns of each configured benchmark over the same dates, and the time-weighted returns in excess of them.
+	Benchmarks map[string]BenchmarkComparison `json:"benchmarks"`
 }
 
 // Constructor for a new PortfolioSummary object.
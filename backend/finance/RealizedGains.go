@@ -0,0 +1,140 @@
+package finance
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Definition of the shares of one lot closed by a sale, used for tax reporting.
+type ClosedLot struct {
+	Ticker       string    `json:"ticker"`
+	LotId        string    `json:"lotId,omitempty"`
+	Shares       float64   `json:"shares"`
+	DateAcquired time.Time `json:"dateAcquired"`
+	DateSold     time.Time `json:"dateSold"`
+	Proceeds     float64   `json:"proceeds"`
+	CostBasis    float64   `json:"costBasis"`
+	Gain         float64   `json:"gain"`
+	LongTerm     bool      `json:"longTerm"`
+	// Portion of a loss disallowed by the wash sale rule (already added back to Gain).
+	WashSaleDisallowed float64 `json:"washSaleDisallowed,omitempty"`
+	// Txn index of the open lot the shares were sold from.
+	sourceLot int
+}
+
+// Summary of realized gains over a tax year, split by holding period.
+type RealizedGainSummary struct {
+	ShortTermProceeds  float64 `json:"shortTermProceeds"`
+	ShortTermCostBasis float64 `json:"shortTermCostBasis"`
+	ShortTermGain      float64 `json:"shortTermGain"`
+	LongTermProceeds   float64 `json:"longTermProceeds"`
+	LongTermCostBasis  float64 `json:"longTermCostBasis"`
+	LongTermGain       float64 `json:"longTermGain"`
+	TotalGain          float64 `json:"totalGain"`
+}
+
+// Definition of the realized gains report for a tax year, portfolio-wide and per equity.
+type RealizedGainsReport struct {
+	Year      int                             `json:"year"`
+	Portfolio RealizedGainSummary             `json:"portfolio"`
+	Equities  map[string]*RealizedGainSummary `json:"equities"`
+	Lots      []ClosedLot                     `json:"lots"`
+}
+
+// A holding is long-term if sold more than one year after it was acquired.
+func isLongTermHolding(acquired time.Time, sold time.Time) bool {
+	return getUtcDate(sold).After(getUtcDate(acquired).AddDate(1, 0, 0))
+}
+
+// Get the lots closed by sales of this equity, in the order they were sold.
+func (s *Equity) GetClosedLots() []ClosedLot {
+	return s.closedLots
+}
+
+// Add a closed lot to the running totals of this summary.
+func (gs *RealizedGainSummary) add(lot ClosedLot) {
+	if lot.LongTerm {
+		gs.LongTermProceeds += lot.Proceeds
+		gs.LongTermCostBasis += lot.CostBasis
+		gs.LongTermGain += lot.Gain
+	} else {
+		gs.ShortTermProceeds += lot.Proceeds
+		gs.ShortTermCostBasis += lot.CostBasis
+		gs.ShortTermGain += lot.Gain
+	}
+	gs.TotalGain += lot.Gain
+}
+
+// Constructor for a new RealizedGainsReport, summarizing the given closed lots that were sold in the tax year.
+func NewRealizedGainsReport(year int, closedLots []ClosedLot) *RealizedGainsReport {
+	var r RealizedGainsReport
+	r.Year = year
+	r.Equities = make(map[string]*RealizedGainSummary)
+	r.Lots = make([]ClosedLot, 0)
+	for _, lot := range closedLots {
+		if lot.DateSold.Year() != year {
+			continue
+		}
+		r.Lots = append(r.Lots, lot)
+		r.Portfolio.add(lot)
+		if _, ok := r.Equities[lot.Ticker]; !ok {
+			r.Equities[lot.Ticker] = &RealizedGainSummary{}
+		}
+		r.Equities[lot.Ticker].add(lot)
+	}
+	// Order the lots by sale date, then ticker, using anonymous function.
+	sort.SliceStable(r.Lots, func(i, j int) bool {
+		if !r.Lots[i].DateSold.Equal(r.Lots[j].DateSold) {
+			return r.Lots[i].DateSold.Before(r.Lots[j].DateSold)
+		}
+		return r.Lots[i].Ticker < r.Lots[j].Ticker
+	})
+	return &r
+}
+
+// Header row of the Form 8949-style realized gains export.
+var form8949Header = []string{"Term", "Description", "Date Acquired", "Date Sold", "Proceeds", "Cost Basis",
+	"Adjustment Code", "Adjustment Amount", "Gain or Loss"}
+
+// Write one Form 8949-style row per closed lot in the report, short-term lots (Part I) followed by long-term lots
+// (Part II). Wash sale adjustments use code W, with the disallowed loss as the adjustment amount.
+func WriteForm8949Csv(writer io.Writer, report *RealizedGainsReport) error {
+	w := csv.NewWriter(writer)
+	if err := w.Write(form8949Header); err != nil {
+		return err
+	}
+	money := func(val float64) string {
+		return strconv.FormatFloat(val, 'f', 2, 64)
+	}
+	for _, longTerm := range []bool{false, true} {
+		for _, lot := range report.Lots {
+			if lot.LongTerm != longTerm {
+				continue
+			}
+			term := "Short"
+			if lot.LongTerm {
+				term = "Long"
+			}
+			// Shares without a known purchase lot have no acquisition date.
+			dateAcquired := "VARIOUS"
+			if !lot.DateAcquired.IsZero() {
+				dateAcquired = lot.DateAcquired.Format("01/02/2006")
+			}
+			adjustmentCode, adjustmentAmount := "", ""
+			if lot.WashSaleDisallowed > 0 {
+				adjustmentCode, adjustmentAmount = "W", money(lot.WashSaleDisallowed)
+			}
+			row := []string{term, strconv.FormatFloat(lot.Shares, 'f', -1, 64) + " sh " + lot.Ticker, dateAcquired,
+				lot.DateSold.Format("01/02/2006"), money(lot.Proceeds), money(lot.CostBasis), adjustmentCode,
+				adjustmentAmount, money(lot.Gain)}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,158 @@
+package finance
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+// Definition of the current and target allocation of a ticker, sector or equity type. Weights are % of the
+// portfolio's value including cash, and Drift is the current weight less the target.
+type AllocationDrift struct {
+	Name          string  `json:"name"`
+	CurrentValue  float64 `json:"currentValue"`
+	CurrentWeight float64 `json:"currentWeight"`
+	TargetValue   float64 `json:"targetValue"`
+	TargetWeight  float64 `json:"targetWeight"`
+	Drift         float64 `json:"drift"`
+}
+
+// Definition of a proposed trade to move a group towards its target. The ticker is blank when a group has no
+// holdings to trade, leaving the choice of equity to us.
+type RebalanceTrade struct {
+	Group  string  `json:"group"`
+	Ticker string  `json:"ticker"`
+	Action string  `json:"action"`
+	Amount float64 `json:"amount"`
+	Shares float64 `json:"shares"`
+}
+
+// Definition of the drift of a portfolio from its target allocation, and the trades proposed to return to it.
+type Rebalance struct {
+	Scope      string            `json:"scope"`
+	TotalValue float64           `json:"totalValue"`
+	Cash       float64           `json:"cash"`
+	CashAfter  float64           `json:"cashAfter"`
+	Groups     []AllocationDrift `json:"groups"`
+	Trades     []RebalanceTrade  `json:"trades"`
+}
+
+// Helper function to get the name of the group an equity falls in for the given scope.
+func allocationGroup(s *Equity, scope string) string {
+	switch scope {
+	case data.AllocationScopeSector:
+		if s.Sector == "" {
+			return "Other"
+		}
+		return s.Sector
+	case data.AllocationScopeEquityType:
+		return s.EquityType
+	}
+	return s.Ticker
+}
+
+// Calculate the drift of the equities from the targets of the given scope, and the trades to return to target using
+// the cash balance as available funds. Holdings without a target have a target of zero. Trades smaller than the
+// minimum are skipped. With no sells, only the cash is used, split between the underweight groups in proportion to
+// their shortfall.
+func CalculateRebalance(equities []*Equity, targets []data.AllocationTarget, scope string, minTrade float64, noSells bool) (Rebalance, error) {
+	var r Rebalance
+	r.Scope = scope
+	targetWeights := make(map[string]float64)
+	totalWeight := 0.0
+	for _, target := range targets {
+		if target.Scope == scope {
+			targetWeights[target.Name] += target.Weight
+			totalWeight += target.Weight
+		}
+	}
+	if len(targetWeights) == 0 {
+		return r, errors.New("No allocation targets defined for scope " + scope)
+	}
+	if totalWeight > 100.001 {
+		return r, errors.New("Allocation targets for scope " + scope + " total more than 100%")
+	}
+	// Total the current value of each group, and its holdings.
+	currentValues := make(map[string]float64)
+	holdings := make(map[string][]*Equity)
+	for _, s := range equities {
+		if s.Ticker == "CASH" {
+			r.Cash += s.MarketValue
+		} else if s.CurrentlyHeld && s.MarketValue > 0 {
+			group := allocationGroup(s, scope)
+			currentValues[group] += s.MarketValue
+			holdings[group] = append(holdings[group], s)
+		}
+	}
+	r.TotalValue = r.Cash
+	for _, value := range currentValues {
+		r.TotalValue += value
+	}
+	names := make([]string, 0)
+	for name := range targetWeights {
+		names = append(names, name)
+	}
+	for name := range currentValues {
+		if _, ok := targetWeights[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	shortfall := 0.0
+	for _, name := range names {
+		drift := AllocationDrift{Name: name, CurrentValue: currentValues[name], TargetWeight: targetWeights[name]}
+		drift.TargetValue = drift.TargetWeight / 100.0 * r.TotalValue
+		if r.TotalValue > 0.001 {
+			drift.CurrentWeight = drift.CurrentValue / r.TotalValue * 100.0
+		}
+		drift.Drift = drift.CurrentWeight - drift.TargetWeight
+		r.Groups = append(r.Groups, drift)
+		shortfall += math.Max(drift.TargetValue-drift.CurrentValue, 0)
+	}
+	// Without sells, scale the buys down to the cash available.
+	buyScale := 1.0
+	if noSells && shortfall > r.Cash {
+		buyScale = math.Max(r.Cash, 0) / shortfall
+	}
+	r.CashAfter = r.Cash
+	for _, drift := range r.Groups {
+		amount := drift.TargetValue - drift.CurrentValue
+		if amount > 0 {
+			amount *= buyScale
+		} else if noSells {
+			continue
+		}
+		if math.Abs(amount) < minTrade || math.Abs(amount) < 0.01 {
+			continue
+		}
+		r.CashAfter -= amount
+		r.Trades = append(r.Trades, splitRebalanceTrade(drift.Name, amount, holdings[drift.Name], drift.CurrentValue)...)
+	}
+	return r, nil
+}
+
+// Helper function to split a group's trade across its holdings in proportion to their market values.
+func splitRebalanceTrade(group string, amount float64, holdings []*Equity, groupValue float64) []RebalanceTrade {
+	action := "Buy"
+	if amount < 0 {
+		action = "Sell"
+	}
+	if len(holdings) == 0 || groupValue <= 0 {
+		return []RebalanceTrade{{Group: group, Action: action, Amount: math.Abs(amount)}}
+	}
+	sort.Slice(holdings, func(i, j int) bool {
+		return holdings[i].Ticker < holdings[j].Ticker
+	})
+	trades := make([]RebalanceTrade, 0, len(holdings))
+	for _, s := range holdings {
+		trade := RebalanceTrade{Group: group, Ticker: s.Ticker, Action: action,
+			Amount: math.Abs(amount) * s.MarketValue / groupValue}
+		if s.MarketPrice > 0 {
+			trade.Shares = trade.Amount / s.MarketPrice
+		}
+		trades = append(trades, trade)
+	}
+	return trades
+}
@@ -0,0 +1,165 @@
+package finance
+
+import (
+	"math"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+// Number of trading days per year, used to annualize when the history is too short to estimate it.
+const tradingDaysPerYear = 252.0
+
+// Definition of the risk metrics of a portfolio or equity over its daily return history. Returns, volatility,
+// drawdown and alpha are percentages, annualized where noted.
+type RiskMetrics struct {
+	StartDate         time.Time `json:"startDate"`
+	EndDate           time.Time `json:"endDate"`
+	AnnualizedReturn  float64   `json:"annualizedReturn"`
+	Volatility        float64   `json:"volatility"`
+	SharpeRatio       float64   `json:"sharpeRatio"`
+	SortinoRatio      float64   `json:"sortinoRatio"`
+	MaxDrawdown       float64   `json:"maxDrawdown"`
+	MaxDrawdownPeak   time.Time `json:"maxDrawdownPeak"`
+	MaxDrawdownTrough time.Time `json:"maxDrawdownTrough"`
+	Beta              float64   `json:"beta"`
+	Alpha             float64   `json:"alpha"`
+}
+
+// Helper function to get the closing price on each date of a quote history.
+func closesByDate(quote data.Quote) map[time.Time]float64 {
+	closes := make(map[time.Time]float64)
+	for idx, date := range quote.Date {
+		if idx < len(quote.Close) {
+			closes[getUtcDate(date)] = quote.Close[idx]
+		}
+	}
+	return closes
+}
+
+// Calculate the risk metrics of a daily return history, against the benchmark's daily closes. The risk-free rate is
+// an annual rate (e.g. 0.04 for 4%).
+func CalculateRiskMetrics(returns []DailyReturn, benchmark data.Quote, riskFreeRate float64) RiskMetrics {
+	var rm RiskMetrics
+	if len(returns) < 2 {
+		return rm
+	}
+	rm.StartDate = returns[0].PrevDate
+	rm.EndDate = returns[len(returns)-1].Date
+	n := float64(len(returns))
+	// Estimate the periods per year from the history, since crypto also trades on weekends.
+	periodsPerYear := tradingDaysPerYear
+	if years := rm.EndDate.Sub(rm.StartDate).Hours() / 24 / 365.25; years >= 0.25 {
+		periodsPerYear = n / years
+	}
+	dailyRiskFree := riskFreeRate / periodsPerYear
+
+	// Calculate the growth, mean, downside deviation and drawdown from the daily returns.
+	growth, peakGrowth := 1.0, 1.0
+	peakDate := rm.StartDate
+	sumExcess, sumDownside := 0.0, 0.0
+	for _, daily := range returns {
+		excess := daily.Return - dailyRiskFree
+		sumExcess += excess
+		if excess < 0 {
+			sumDownside += excess * excess
+		}
+		growth *= 1 + daily.Return
+		if growth > peakGrowth {
+			peakGrowth, peakDate = growth, daily.Date
+		} else if drawdown := (growth/peakGrowth - 1) * 100.0; drawdown < rm.MaxDrawdown {
+			rm.MaxDrawdown, rm.MaxDrawdownPeak, rm.MaxDrawdownTrough = drawdown, peakDate, daily.Date
+		}
+	}
+	meanExcess := sumExcess / n
+	variance := 0.0
+	for _, daily := range returns {
+		variance += math.Pow(daily.Return-dailyRiskFree-meanExcess, 2)
+	}
+	stdDev := math.Sqrt(variance / (n - 1))
+	downsideDev := math.Sqrt(sumDownside / n)
+	if growth > 0 {
+		rm.AnnualizedReturn = (math.Pow(growth, periodsPerYear/n) - 1) * 100.0
+	}
+	rm.Volatility = stdDev * math.Sqrt(periodsPerYear) * 100.0
+	if stdDev > 0 {
+		rm.SharpeRatio = meanExcess * math.Sqrt(periodsPerYear) / stdDev
+	}
+	if downsideDev > 0 {
+		rm.SortinoRatio = meanExcess * math.Sqrt(periodsPerYear) / downsideDev
+	}
+	rm.Beta, rm.Alpha = calculateBetaAlpha(returns, closesByDate(benchmark), dailyRiskFree, periodsPerYear)
+	return rm
+}
+
+// Calculate the beta of the daily returns against the benchmark's returns over the same dates, and the annualized
+// Jensen's alpha (%). Dates without a benchmark close on both ends are skipped.
+func calculateBetaAlpha(returns []DailyReturn, benchmarkCloses map[time.Time]float64, dailyRiskFree float64, periodsPerYear float64) (float64, float64) {
+	var ownReturns, benchReturns []float64
+	for _, daily := range returns {
+		prevClose, okPrev := benchmarkCloses[getUtcDate(daily.PrevDate)]
+		curClose, okCur := benchmarkCloses[getUtcDate(daily.Date)]
+		if okPrev && okCur && prevClose > 0 {
+			ownReturns = append(ownReturns, daily.Return)
+			benchReturns = append(benchReturns, curClose/prevClose-1)
+		}
+	}
+	if len(ownReturns) < 2 {
+		return 0.0, 0.0
+	}
+	meanOwn, meanBench := mean(ownReturns), mean(benchReturns)
+	covariance, benchVariance := 0.0, 0.0
+	for idx := range ownReturns {
+		covariance += (ownReturns[idx] - meanOwn) * (benchReturns[idx] - meanBench)
+		benchVariance += math.Pow(benchReturns[idx]-meanBench, 2)
+	}
+	if benchVariance == 0 {
+		return 0.0, 0.0
+	}
+	beta := covariance / benchVariance
+	alpha := (meanOwn - dailyRiskFree - beta*(meanBench-dailyRiskFree)) * periodsPerYear * 100.0
+	return beta, alpha
+}
+
+// Helper function to get the average of the values.
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0.0
+	}
+	sum := 0.0
+	for _, val := range values {
+		sum += val
+	}
+	return sum / float64(len(values))
+}
+
+// Calculate this equity's risk metrics from its daily closing prices over the period it was held.
+func (s *Equity) CalculateRiskMetrics(riskFreeRate float64) {
+	held := make(map[time.Time]bool)
+	for date := range s.ValueHistory {
+		held[time.Unix(date, 0).UTC()] = true
+	}
+	prices := make(map[time.Time]float64)
+	for date, close := range closesByDate(s.priceHistory) {
+		if held[date] {
+			prices[date] = close
+		}
+	}
+	s.Risk = CalculateRiskMetrics(CalculateDailyReturns(prices, nil), s.sp500History, riskFreeRate)
+}
+
+// Get the flows into (positive) and out of (negative) the catalogue's holdings, so daily returns of the holdings'
+// value exclude purchases and sales.
+func (ec *EquityCatalogue) GetHoldingsCashFlows() []CashFlow {
+	flows := make([]CashFlow, 0)
+	for _, txn := range ec.transactions {
+		switch txn.Action {
+		case "Buy", "ReinvestedDividend":
+			flows = append(flows, CashFlow{Date: txn.DateTime, Amount: txn.Value})
+		case "Sell", "Merger":
+			flows = append(flows, CashFlow{Date: txn.DateTime, Amount: -txn.Value})
+		}
+	}
+	sortCashFlows(flows)
+	return flows
+}
@@ -0,0 +1,78 @@
+package finance
+
+import (
+	"time"
+)
+
+// Sources of the cash flows replayed into a shadow portfolio.
+const (
+	ShadowFlowsTrades   = "trades"
+	ShadowFlowsDeposits = "deposits"
+)
+
+// Definition of a hypothetical portfolio that put the same cash flows into a benchmark, to compare against the
+// actual portfolio's value history.
+type ShadowPortfolio struct {
+	Benchmark      string                `json:"benchmark"`
+	History        map[time.Time]float64 `json:"history"`
+	MarketValue    float64               `json:"marketValue"`
+	PortfolioValue float64               `json:"portfolioValue"`
+	// The actual portfolio's latest value, less the shadow portfolio's (positive when we beat the benchmark).
+	Difference float64 `json:"difference"`
+}
+
+// Constructor for a new ShadowPortfolio, buying (or selling) the benchmark at its close on the date of each cash
+// flow, valued daily through the last date of the actual portfolio's history.
+func NewShadowPortfolio(b *Benchmark, flows []CashFlow, portfolioHistory map[time.Time]float64) *ShadowPortfolio {
+	var sp ShadowPortfolio
+	sp.Benchmark = b.Name
+	sp.History = make(map[time.Time]float64)
+	portfolioDates := sortedDates(portfolioHistory)
+	if len(flows) == 0 || len(portfolioDates) == 0 {
+		return &sp
+	}
+	lastDate := portfolioDates[len(portfolioDates)-1]
+	sortCashFlows(flows)
+	units := 0.0
+	flowIdx := 0
+	for idx, date := range b.History.Date {
+		if date.After(lastDate) {
+			break
+		}
+		close := b.History.Close[idx]
+		// Flows on this date (or a market holiday before it) trade at this close. Heavy withdrawals can
+		// leave negative units, which show the shortfall the benchmark would have had.
+		for flowIdx < len(flows) && !getUtcDate(flows[flowIdx].Date).After(date) {
+			if close > 0 {
+				units += flows[flowIdx].Amount / close
+			}
+			flowIdx++
+		}
+		if flowIdx == 0 {
+			continue
+		}
+		sp.History[date] = units * close
+		sp.MarketValue = units * close
+	}
+	sp.PortfolioValue = portfolioHistory[lastDate]
+	sp.Difference = sp.PortfolioValue - sp.MarketValue
+	return &sp
+}
+
+// Replay the cash flows into a shadow portfolio for each benchmark.
+func CalculateShadowPortfolios(benchmarks []*Benchmark, flows []CashFlow, portfolioHistory map[time.Time]float64) []*ShadowPortfolio {
+	shadows := make([]*ShadowPortfolio, 0, len(benchmarks))
+	for _, b := range benchmarks {
+		shadows = append(shadows, NewShadowPortfolio(b, flows, portfolioHistory))
+	}
+	return shadows
+}
+
+// Get the cash flows to replay into a shadow portfolio, and the value history to compare it against: the buys and
+// sales of equities against the holdings' value, or the deposits and withdrawals against the total value with cash.
+func (ec *EquityCatalogue) GetShadowInputs(flowSource string) ([]CashFlow, map[time.Time]float64) {
+	if flowSource == ShadowFlowsDeposits {
+		return ec.GetExternalCashFlows(), ec.GetValueHistory()
+	}
+	return ec.GetHoldingsCashFlows(), ec.PortfolioHistory
+}
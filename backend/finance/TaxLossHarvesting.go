@@ -0,0 +1,99 @@
+package finance
+
+import (
+	"sort"
+	"time"
+)
+
+// Definition of an open lot with an unrealized loss that could be sold to realize the loss.
+type HarvestCandidate struct {
+	Ticker         string    `json:"ticker"`
+	LotId          string    `json:"lotId,omitempty"`
+	Acquired       time.Time `json:"acquired"`
+	Shares         float64   `json:"shares"`
+	CostBasis      float64   `json:"costBasis"`
+	MarketValue    float64   `json:"marketValue"`
+	UnrealizedLoss float64   `json:"unrealizedLoss"`
+	LossPercentage float64   `json:"lossPercentage"`
+	LongTerm       bool      `json:"longTerm"`
+	// Selling now would be a wash sale, due to shares of the equity bought within the last 30 days.
+	WashSale      bool      `json:"washSale"`
+	LastPurchased time.Time `json:"lastPurchased,omitempty"`
+}
+
+// Definition of the tax-loss harvesting candidates across a portfolio, ranked by loss, with the short and long term
+// losses that could be realized.
+type HarvestReport struct {
+	Date          time.Time          `json:"date"`
+	ShortTermLoss float64            `json:"shortTermLoss"`
+	LongTermLoss  float64            `json:"longTermLoss"`
+	Candidates    []HarvestCandidate `json:"candidates"`
+}
+
+// Get the open lots of this equity with an unrealized loss of at least the minimum (in $) at the current price, if
+// sold on the given date.
+func (s *Equity) GetHarvestCandidates(minLoss float64, date time.Time) []HarvestCandidate {
+	candidates := make([]HarvestCandidate, 0)
+	if s.Ticker == "CASH" || !s.CurrentlyHeld || s.MarketPrice <= 0 {
+		return candidates
+	}
+	for _, lot := range s.buyQ {
+		if lot.Shares < lotShareTolerance {
+			continue
+		}
+		c := HarvestCandidate{
+			Ticker:      s.Ticker,
+			LotId:       lot.LotId,
+			Acquired:    lot.acquisitionDate(),
+			Shares:      lot.Shares,
+			CostBasis:   lot.Shares * lot.Price,
+			MarketValue: lot.Shares * s.MarketPrice}
+		c.UnrealizedLoss = c.MarketValue - c.CostBasis
+		if -c.UnrealizedLoss < minLoss || c.UnrealizedLoss >= 0 {
+			continue
+		}
+		c.LossPercentage = c.UnrealizedLoss / c.CostBasis * 100.0
+		c.LongTerm = isLongTermHolding(c.Acquired, date)
+		c.LastPurchased = s.lastPurchaseInWashSaleWindow(int(lot.id), date)
+		c.WashSale = !c.LastPurchased.IsZero()
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// Get the date of the latest purchase of this equity within the wash sale window before a sale on the given date,
+// other than the lot being sold (by its txn index). Returns the zero time if there is none.
+func (s *Equity) lastPurchaseInWashSaleWindow(lotTxnIdx int, saleDate time.Time) time.Time {
+	var last time.Time
+	for idx, t := range s.transactions {
+		if idx == lotTxnIdx || (t.Action != "Buy" && t.Action != "ReinvestedDividend") {
+			continue
+		}
+		if !getUtcDate(t.DateTime).After(getUtcDate(saleDate)) && inWashSaleWindow(t.DateTime, saleDate) && t.DateTime.After(last) {
+			last = t.DateTime
+		}
+	}
+	return last
+}
+
+// Find the open lots across the given equities with an unrealized loss of at least the minimum (in $), if sold on
+// the given date, largest loss first.
+func FindHarvestCandidates(equities []*Equity, minLoss float64, date time.Time) HarvestReport {
+	var r HarvestReport
+	r.Date = getUtcDate(date)
+	r.Candidates = make([]HarvestCandidate, 0)
+	for _, s := range equities {
+		r.Candidates = append(r.Candidates, s.GetHarvestCandidates(minLoss, date)...)
+	}
+	sort.SliceStable(r.Candidates, func(i, j int) bool {
+		return r.Candidates[i].UnrealizedLoss < r.Candidates[j].UnrealizedLoss
+	})
+	for _, c := range r.Candidates {
+		if c.LongTerm {
+			r.LongTermLoss += c.UnrealizedLoss
+		} else {
+			r.ShortTermLoss += c.UnrealizedLoss
+		}
+	}
+	return r
+}
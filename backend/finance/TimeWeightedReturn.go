@@ -0,0 +1,132 @@
+package finance
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Definition of an external cash flow into (positive) or out of (negative) a portfolio.
+type CashFlow struct {
+	Date   time.Time `json:"date"`
+	Amount float64   `json:"amount"`
+}
+
+// Definition of the time-weighted returns (%) of a portfolio, which remove the effect of the timing of cash flows.
+type TimeWeightedReturns struct {
+	Annual              map[int]float64 `json:"annual"`
+	Ytd                 float64         `json:"ytd"`
+	SinceInception      float64         `json:"sinceInception"`
+	AnnualizedInception float64         `json:"annualizedInception"`
+}
+
+// Helper function to get the dates of a value history in chronological order.
+func sortedDates(history map[time.Time]float64) []time.Time {
+	dates := make([]time.Time, 0, len(history))
+	for date := range history {
+		dates = append(dates, date)
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+	return dates
+}
+
+// Helper function to order cash flows by date.
+func sortCashFlows(flows []CashFlow) {
+	sort.SliceStable(flows, func(i, j int) bool {
+		return flows[i].Date.Before(flows[j].Date)
+	})
+}
+
+// Combine value histories with different dates (e.g. crypto trades on weekends), carrying each history's last value
+// forward to the dates it's missing.
+func CombineValueHistories(histories ...map[time.Time]float64) map[time.Time]float64 {
+	allDates := make(map[time.Time]float64)
+	for _, history := range histories {
+		for date := range history {
+			allDates[date] = 0.0
+		}
+	}
+	combined := make(map[time.Time]float64)
+	for _, history := range histories {
+		lastValue := 0.0
+		for _, date := range sortedDates(allDates) {
+			if value, ok := history[date]; ok {
+				lastValue = value
+			}
+			combined[date] += lastValue
+		}
+	}
+	return combined
+}
+
+// Definition of the return of a portfolio between two consecutive valuation dates.
+type DailyReturn struct {
+	PrevDate time.Time
+	Date     time.Time
+	Return   float64
+}
+
+// Calculate the return between each pair of consecutive dates in a daily value history, excluding the effect of
+// cash flows. Flows are assumed to arrive at the start of the first valuation date on or after them, so each day's
+// return is the day's ending value over the prior day's value plus the flows. Periods without any value are skipped.
+func CalculateDailyReturns(valueHistory map[time.Time]float64, cashFlows []CashFlow) []DailyReturn {
+	returns := make([]DailyReturn, 0)
+	dates := sortedDates(valueHistory)
+	if len(dates) < 2 {
+		return returns
+	}
+	flows := append([]CashFlow(nil), cashFlows...)
+	sortCashFlows(flows)
+	// Skip flows already included in the first value.
+	fIdx := 0
+	for fIdx < len(flows) && flows[fIdx].Date.Before(dates[0].Add(24*time.Hour)) {
+		fIdx++
+	}
+	for dIdx := 1; dIdx < len(dates); dIdx++ {
+		// Sum the flows since the prior valuation date, through the end of this date.
+		netFlow := 0.0
+		for fIdx < len(flows) && flows[fIdx].Date.Before(dates[dIdx].Add(24*time.Hour)) {
+			netFlow += flows[fIdx].Amount
+			fIdx++
+		}
+		if startValue := valueHistory[dates[dIdx-1]] + netFlow; startValue > 0.001 {
+			returns = append(returns, DailyReturn{PrevDate: dates[dIdx-1], Date: dates[dIdx],
+				Return: valueHistory[dates[dIdx]]/startValue - 1})
+		}
+	}
+	return returns
+}
+
+// Calculate daily-linked time-weighted returns from a portfolio's daily value history and its external cash flows.
+func CalculateTimeWeightedReturns(valueHistory map[time.Time]float64, cashFlows []CashFlow) TimeWeightedReturns {
+	var twr TimeWeightedReturns
+	twr.Annual = make(map[int]float64)
+	returns := CalculateDailyReturns(valueHistory, cashFlows)
+	if len(returns) == 0 {
+		return twr
+	}
+	growthByYear := make(map[int]float64)
+	totalGrowth := 1.0
+	for _, daily := range returns {
+		if _, ok := growthByYear[daily.Date.Year()]; !ok {
+			growthByYear[daily.Date.Year()] = 1.0
+		}
+		growthByYear[daily.Date.Year()] *= 1 + daily.Return
+		totalGrowth *= 1 + daily.Return
+	}
+	for year, growth := range growthByYear {
+		twr.Annual[year] = (growth - 1) * 100.0
+	}
+	twr.Ytd = twr.Annual[time.Now().Year()]
+	twr.SinceInception = (totalGrowth - 1) * 100.0
+	// Annualize over the full history, once it spans at least one year.
+	years := returns[len(returns)-1].Date.Sub(returns[0].PrevDate).Hours() / 24 / 365.25
+	if years >= 1 && totalGrowth > 0 {
+		twr.AnnualizedInception = (math.Pow(totalGrowth, 1/years) - 1) * 100.0
+	} else {
+		twr.AnnualizedInception = twr.SinceInception
+	}
+	return twr
+}
@@ -19,6 +19,44 @@ type Transaction struct {
 	TotalReturn  float64   `json:"totalReturn"`
 	Sp500Return  float64   `json:"sp500Return"`
 	ExcessReturn float64   `json:"excessReturn"`
+	// Return (%) of each configured benchmark over the life of the transaction, and the excess return over it.
+	BenchmarkReturns       map[string]float64 `json:"benchmarkReturns,omitempty"`
+	BenchmarkExcessReturns map[string]float64 `json:"benchmarkExcessReturns,omitempty"`
+	LotId                  string             `json:"lotId,omitempty"`
+	CostBasisMethod        string             `json:"costBasisMethod,omitempty"`
+	// Wash sale results: on a sale, the loss disallowed; on a buy, the disallowed loss added to its basis.
+	WashSale               bool    `json:"washSale"`
+	WashSaleDisallowed     float64 `json:"washSaleDisallowed"`
+	BasisAdjustment        float64 `json:"basisAdjustment"`
+	washSaleReplacedShares float64
+	// Problem found processing the transaction (e.g. a sale of more shares than held), if any.
+	Error string `json:"error,omitempty"`
+	// For shares received in a merger, the acquisition date of the original lot (for holding periods).
+	acquired time.Time
+	// For a merger, the fraction of basis carried to the acquirer's shares.
+	basisAllocation float64
+	// For a merger or spin-off, the market value of the shares moved to the new ticker on its date (zero if unknown).
+	movedValue float64
+	// For a buy or sale, the fees paid on the same date, included in the lot's basis or taken from the proceeds.
+	fee float64
+	// For a fee, whether it was paid on a buy or sale (and so isn't counted separately).
+	tradeFee bool
+}
+
+// Get the proceeds per share of a sale, net of any fee paid on it.
+func (t *Transaction) netPrice() float64 {
+	if t.fee != 0 && t.Shares > 0 {
+		return t.Price - t.fee/t.Shares
+	}
+	return t.Price
+}
+
+// Get the date the shares of this lot were acquired, carried over from the original lot for shares received in a merger.
+func (t *Transaction) acquisitionDate() time.Time {
+	if !t.acquired.IsZero() {
+		return t.acquired
+	}
+	return t.DateTime
 }
 
 func NormalizeAmerican(num string) string {
@@ -36,8 +74,11 @@ func NewTransaction(dTime string, tkr string, act string, numShares string, txnP
 	// Place the transaction times at midday, so we can order stock splits at market open first.
 	t.DateTime = t.DateTime.Add(time.Hour * 12)
 	t.Ticker = tkr
-	// Verify the action falls into accepted values.
-	if act != "Buy" && act != "Sell" && act != "Deposit" && act != "Withdraw" {
+	// Verify the action falls into accepted values. For Dividend, Interest and Fee, the shares field holds the
+	// cash amount (price left blank). For ReinvestedDividend, it holds the shares purchased with the dividend.
+	switch act {
+	case "Buy", "Sell", "Deposit", "Withdraw", "Dividend", "ReinvestedDividend", "Interest", "Fee":
+	default:
 		log.Fatalf("Unable to parse action field from transaction: %v", act)
 	}
 	t.Action = act
@@ -0,0 +1,98 @@
+package finance
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// Number of days before or after a sale at a loss in which a repurchase triggers the wash sale rule.
+const washSaleWindowDays = 30
+
+// Check if the sale at the given txn index closed any lots at a loss while the equity was repurchased within 30
+// days before or after the sale. If so, disallow the loss (up to the number of replacement shares) and roll it into
+// the basis of the replacement lots.
+func (s *Equity) applyWashSaleRule(txnIdx int, firstClosedLot int) {
+	t := &s.transactions[txnIdx]
+	// The unsold shares of the lots this sale closed weren't bought as replacements.
+	soldLots := make(map[int]bool)
+	for lotIdx := firstClosedLot; lotIdx < len(s.closedLots); lotIdx++ {
+		soldLots[s.closedLots[lotIdx].sourceLot] = true
+	}
+	for lotIdx := firstClosedLot; lotIdx < len(s.closedLots); lotIdx++ {
+		closed := &s.closedLots[lotIdx]
+		if closed.Gain >= 0 || closed.Shares <= 0 {
+			continue
+		}
+		lossPerShare := -closed.Gain / closed.Shares
+		unmatchedShares := closed.Shares
+		// Replacement shares bought before the sale are still open lots in the buy queue.
+		for i := range s.buyQ {
+			if unmatchedShares < lotShareTolerance {
+				break
+			}
+			lot := &s.buyQ[i]
+			// Shares received in a merger or spin-off weren't purchased, so can't replace sold shares.
+			if soldLots[int(lot.id)] || isReceivedShares(lot.Action) || lot.DateTime.After(t.DateTime) || !inWashSaleWindow(lot.DateTime, t.DateTime) {
+				continue
+			}
+			replacedShares := s.washSaleReplacementShares(&s.transactions[lot.id], lot.Shares, unmatchedShares)
+			if replacedShares <= 0 {
+				continue
+			}
+			disallowed := replacedShares * lossPerShare
+			lot.Price += disallowed / lot.Shares
+			s.transactions[lot.id].BasisAdjustment += disallowed
+			s.disallowLoss(t, closed, disallowed)
+			unmatchedShares -= replacedShares
+		}
+		// Replacement shares bought after the sale are adjusted before they are added to the buy queue.
+		for j := txnIdx + 1; j < len(s.transactions) && inWashSaleWindow(s.transactions[j].DateTime, t.DateTime); j++ {
+			if unmatchedShares < lotShareTolerance {
+				break
+			}
+			buy := &s.transactions[j]
+			if buy.Action != "Buy" && buy.Action != "ReinvestedDividend" {
+				continue
+			}
+			replacedShares := s.washSaleReplacementShares(buy, buy.Shares, unmatchedShares)
+			if replacedShares <= 0 {
+				continue
+			}
+			disallowed := replacedShares * lossPerShare
+			buy.BasisAdjustment += disallowed
+			s.disallowLoss(t, closed, disallowed)
+			unmatchedShares -= replacedShares
+		}
+	}
+	if t.WashSale {
+		log.Printf("Wash sale: %s sale on %s disallowed $%f of loss", s.Ticker, t.DateTime.Format("2006-01-02"), t.WashSaleDisallowed)
+	}
+}
+
+// Get the number of shares of a buy that can replace sold shares, and mark them used. Each purchased share can
+// only serve as the replacement for one sold share.
+func (s *Equity) washSaleReplacementShares(buy *Transaction, availableShares float64, neededShares float64) float64 {
+	availableShares = math.Min(availableShares, buy.Shares-buy.washSaleReplacedShares)
+	replacedShares := math.Min(availableShares, neededShares)
+	if replacedShares < lotShareTolerance {
+		return 0.0
+	}
+	buy.washSaleReplacedShares += replacedShares
+	return replacedShares
+}
+
+// Record the disallowed portion of a loss on the sale and its closed lot, and remove it from the realized gain.
+func (s *Equity) disallowLoss(sale *Transaction, closed *ClosedLot, disallowed float64) {
+	sale.WashSale = true
+	sale.WashSaleDisallowed += disallowed
+	closed.WashSaleDisallowed += disallowed
+	closed.Gain += disallowed
+	s.RealizedGain += disallowed
+}
+
+// Helper function to check if a date falls within the wash sale window around a sale.
+func inWashSaleWindow(date time.Time, saleDate time.Time) bool {
+	days := getUtcDate(date).Sub(getUtcDate(saleDate)).Hours() / 24
+	return math.Abs(days) <= washSaleWindowDays
+}
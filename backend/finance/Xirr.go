@@ -0,0 +1,91 @@
+package finance
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Maximum iterations and tolerance of the XIRR solver.
+const (
+	xirrMaxIterations = 100
+	xirrTolerance     = 0.0000001
+)
+
+// Helper function to get the net present value of the cash flows at the given annual rate, and its derivative.
+func xirrNpv(flows []CashFlow, rate float64) (float64, float64) {
+	npv, derivative := 0.0, 0.0
+	for _, flow := range flows {
+		years := flow.Date.Sub(flows[0].Date).Hours() / 24 / 365.0
+		discount := math.Pow(1+rate, years)
+		npv += flow.Amount / discount
+		derivative -= years * flow.Amount / (discount * (1 + rate))
+	}
+	return npv, derivative
+}
+
+// Calculate the annualized internal rate of return (as a fraction) of irregularly-dated cash flows, from the
+// investor's point of view: money invested is negative, and money returned (or the ending value) is positive.
+// The flows must be in date order, and include at least one negative and one positive amount.
+func CalculateXirr(flows []CashFlow) (float64, error) {
+	hasNegative, hasPositive := false, false
+	for _, flow := range flows {
+		hasNegative = hasNegative || flow.Amount < 0
+		hasPositive = hasPositive || flow.Amount > 0
+	}
+	if !hasNegative || !hasPositive {
+		return 0.0, errors.New("XIRR requires both negative and positive cash flows")
+	}
+	// Try Newton's method first, which converges quickly for typical returns.
+	rate := 0.1
+	for i := 0; i < xirrMaxIterations; i++ {
+		npv, derivative := xirrNpv(flows, rate)
+		if math.Abs(npv) < xirrTolerance {
+			return rate, nil
+		}
+		if derivative == 0 || math.IsNaN(npv) {
+			break
+		}
+		next := rate - npv/derivative
+		if next <= -1 || math.IsNaN(next) || math.IsInf(next, 0) {
+			break
+		}
+		if math.Abs(next-rate) < xirrTolerance {
+			return next, nil
+		}
+		rate = next
+	}
+	// Otherwise, fall back to bisection over a bracket where the NPV changes sign.
+	low, high := -0.999999, 1.0
+	npvLow, _ := xirrNpv(flows, low)
+	npvHigh, _ := xirrNpv(flows, high)
+	for npvLow*npvHigh > 0 && high < 1e9 {
+		high *= 10
+		npvHigh, _ = xirrNpv(flows, high)
+	}
+	if npvLow*npvHigh > 0 {
+		return 0.0, errors.New("XIRR did not converge")
+	}
+	for i := 0; i < 4*xirrMaxIterations && high-low > xirrTolerance; i++ {
+		mid := (low + high) / 2
+		npvMid, _ := xirrNpv(flows, mid)
+		if npvMid*npvLow > 0 {
+			low, npvLow = mid, npvMid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2, nil
+}
+
+// Calculate the annualized money-weighted return (%) of an investment's cash flows, valued at the given amount on
+// the given date. Returns zero if the return can't be calculated (e.g. nothing was invested).
+func CalculateMoneyWeightedReturn(flows []CashFlow, endingValue float64, endDate time.Time) float64 {
+	allFlows := append(append([]CashFlow(nil), flows...), CashFlow{Date: endDate, Amount: endingValue})
+	sortCashFlows(allFlows)
+	rate, err := CalculateXirr(allFlows)
+	if err != nil {
+		return 0.0
+	}
+	return rate * 100.0
+}
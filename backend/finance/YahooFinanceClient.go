@@ -0,0 +1,296 @@
+package finance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+// Modules requested from the quoteSummary endpoint. Flattened together, these mirror the yfinance "info" dictionary.
+const yahooQuoteSummaryModules = "price,summaryDetail,financialData,defaultKeyStatistics,assetProfile"
+
+// A native Go client that queries the Yahoo Finance JSON API directly, without the Python yfinance helper.
+type YahooFinanceClient struct {
+	httpClient *http.Client
+	baseUrl    string
+	cookieUrl  string
+	userAgent  string
+	crumb      string
+}
+
+// Structure of the chart endpoint response, used for historical price bars.
+type yahooChartResponse struct {
+	Chart struct {
+		Result []struct {
+			Meta struct {
+				Symbol    string `json:"symbol"`
+				GmtOffset int64  `json:"gmtoffset"`
+			} `json:"meta"`
+			Timestamp []int64 `json:"timestamp"`
+			Events    struct {
+				Splits map[string]struct {
+					Date        int64   `json:"date"`
+					Numerator   float64 `json:"numerator"`
+					Denominator float64 `json:"denominator"`
+				} `json:"splits"`
+			} `json:"events"`
+			Indicators struct {
+				Quote []struct {
+					Open   []*float64 `json:"open"`
+					High   []*float64 `json:"high"`
+					Low    []*float64 `json:"low"`
+					Close  []*float64 `json:"close"`
+					Volume []*float64 `json:"volume"`
+				} `json:"quote"`
+			} `json:"indicators"`
+		} `json:"result"`
+		Error *struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	} `json:"chart"`
+}
+
+// Structure of the quoteSummary endpoint response, used for quotes and fundamentals.
+type yahooQuoteSummaryResponse struct {
+	QuoteSummary struct {
+		Result []map[string]map[string]interface{} `json:"result"`
+		Error  *struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	} `json:"quoteSummary"`
+}
+
+// Constructor for a new YahooFinanceClient.
+func NewYahooFinanceClient() *YahooFinanceClient {
+	var c YahooFinanceClient
+	// Yahoo requires a session cookie to issue the crumb used on authenticated endpoints.
+	jar, _ := cookiejar.New(nil)
+	c.httpClient = &http.Client{Jar: jar, Timeout: 30 * time.Second}
+	c.baseUrl = "https://query2.finance.yahoo.com"
+	c.cookieUrl = "https://fc.yahoo.com"
+	c.userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	return &c
+}
+
+// Issue a GET request to Yahoo and return the response body, retrying a few times on failure (1,2,4 seconds).
+func (c *YahooFinanceClient) get(requestUrl string) ([]byte, error) {
+	var body []byte
+	var err error
+	for retrySecs := 1; ; retrySecs += retrySecs {
+		body, err = c.getOnce(requestUrl)
+		if err == nil || retrySecs >= 8 {
+			break
+		}
+		log.Printf("Warning: Yahoo request failed (%s) - will retry: %v", requestUrl, err)
+		time.Sleep(time.Duration(retrySecs) * time.Second)
+	}
+	return body, err
+}
+
+func (c *YahooFinanceClient) getOnce(requestUrl string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// Obtain a session cookie and crumb from Yahoo, required by the quoteSummary endpoint.
+func (c *YahooFinanceClient) refreshCrumb() error {
+	// The cookie endpoint typically responds with an error status, but still sets the session cookie.
+	c.getOnce(c.cookieUrl)
+	body, err := c.get(c.baseUrl + "/v1/test/getcrumb")
+	if err != nil {
+		return err
+	}
+	crumb := strings.TrimSpace(string(body))
+	if crumb == "" || strings.Contains(crumb, "<") {
+		return errors.New("Yahoo returned an invalid crumb")
+	}
+	c.crumb = crumb
+	return nil
+}
+
+// Query quote and fundamental data for the given tickers (accepts single ticker or comma-separated list of tickers).
+func (c *YahooFinanceClient) GetTickerData(tickers string) *map[string]interface{} {
+	result := make(map[string]interface{})
+	pulled := make([]string, 0)
+	if c.crumb == "" {
+		if err := c.refreshCrumb(); err != nil {
+			log.Printf("WARNING: Could not retrieve Yahoo crumb: %v", err)
+		}
+	}
+	for _, ticker := range strings.Split(tickers, ",") {
+		ticker = strings.TrimSpace(ticker)
+		if ticker == "" {
+			continue
+		}
+		info, err := c.getQuoteSummary(ticker)
+		if err != nil {
+			log.Printf("WARNING: Could not retrieve extended stock info (%s) from Yahoo: %v", ticker, err)
+			// The crumb may have expired, request a new one on the next query.
+			c.crumb = ""
+			continue
+		}
+		result[ticker] = info
+		pulled = append(pulled, ticker)
+	}
+	if len(pulled) > 0 {
+		log.Printf("Successfully pulled Yahoo data for ticker(s): %s", strings.Join(pulled, ","))
+	}
+	return &result
+}
+
+// Query the quoteSummary modules for one ticker, and flatten them into a single yfinance-style info map.
+func (c *YahooFinanceClient) getQuoteSummary(ticker string) (map[string]interface{}, error) {
+	query := url.Values{}
+	query.Set("modules", yahooQuoteSummaryModules)
+	query.Set("crumb", c.crumb)
+	body, err := c.get(c.baseUrl + "/v10/finance/quoteSummary/" + url.PathEscape(ticker) + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var resp yahooQuoteSummaryResponse
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.QuoteSummary.Error != nil {
+		return nil, errors.New(resp.QuoteSummary.Error.Description)
+	}
+	if len(resp.QuoteSummary.Result) == 0 {
+		return nil, errors.New("no quoteSummary result returned")
+	}
+	info := make(map[string]interface{})
+	for _, module := range resp.QuoteSummary.Result[0] {
+		for key, val := range module {
+			// Numeric values are returned as {"raw": 1.23, "fmt": "1.23"}, keep only the raw value.
+			if obj, ok := val.(map[string]interface{}); ok {
+				if raw, ok := obj["raw"]; ok {
+					info[key] = raw
+				}
+				continue
+			}
+			info[key] = val
+		}
+	}
+	return info, nil
+}
+
+// Query daily price history for a ticker between the given dates (YYYY-MM-DD, end date exclusive).
+func (c *YahooFinanceClient) GetHistoricalData(ticker string, startDate string, endDate string) (*data.Quote, error) {
+	start, err := time.Parse("2006-01-02", startDate)
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.Parse("2006-01-02", endDate)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("period1", fmt.Sprint(start.Unix()))
+	query.Set("period2", fmt.Sprint(end.Unix()))
+	query.Set("interval", "1d")
+	body, err := c.get(c.baseUrl + "/v8/finance/chart/" + url.PathEscape(ticker) + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var resp yahooChartResponse
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Chart.Error != nil {
+		return nil, errors.New(resp.Chart.Error.Description)
+	}
+	var quote data.Quote
+	quote.Symbol = ticker
+	if len(resp.Chart.Result) == 0 || len(resp.Chart.Result[0].Indicators.Quote) == 0 {
+		return &quote, nil
+	}
+	res := resp.Chart.Result[0]
+	bars := res.Indicators.Quote[0]
+	for i, ts := range res.Timestamp {
+		// Skip days Yahoo returned without a closing price.
+		if i >= len(bars.Close) || bars.Close[i] == nil {
+			continue
+		}
+		// Shift to the exchange's local time, then save the trading date at midnight UTC (matches yfinance dates).
+		quote.Date = append(quote.Date, getUtcDate(time.Unix(ts+res.Meta.GmtOffset, 0).UTC()))
+		quote.Open = append(quote.Open, valueAt(bars.Open, i))
+		quote.High = append(quote.High, valueAt(bars.High, i))
+		quote.Low = append(quote.Low, valueAt(bars.Low, i))
+		quote.Close = append(quote.Close, *bars.Close[i])
+		quote.Volume = append(quote.Volume, valueAt(bars.Volume, i))
+	}
+	return &quote, nil
+}
+
+// Helper function to safely read a nullable value from a Yahoo indicator array.
+func valueAt(arr []*float64, idx int) float64 {
+	if idx < len(arr) && arr[idx] != nil {
+		return *arr[idx]
+	}
+	return 0.0
+}
+
+// Query the full split history of a ticker from the chart endpoint's split events.
+func (c *YahooFinanceClient) GetSplitHistory(ticker string) ([]data.CorporateAction, error) {
+	query := url.Values{}
+	query.Set("range", "max")
+	query.Set("interval", "1mo")
+	query.Set("events", "split")
+	body, err := c.get(c.baseUrl + "/v8/finance/chart/" + url.PathEscape(ticker) + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var resp yahooChartResponse
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Chart.Error != nil {
+		return nil, errors.New(resp.Chart.Error.Description)
+	}
+	actions := make([]data.CorporateAction, 0)
+	if len(resp.Chart.Result) == 0 {
+		return actions, nil
+	}
+	res := resp.Chart.Result[0]
+	for _, split := range res.Events.Splits {
+		if split.Numerator <= 0 || split.Denominator <= 0 {
+			continue
+		}
+		actions = append(actions, data.CorporateAction{
+			Ticker: ticker,
+			Type:   data.CorporateActionSplit,
+			Date:   getUtcDate(time.Unix(split.Date+res.Meta.GmtOffset, 0).UTC()),
+			Ratio:  split.Numerator / split.Denominator})
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Date.Before(actions[j].Date)
+	})
+	return actions, nil
+}
@@ -0,0 +1,75 @@
+package finance
+
+import (
+	"testing"
+	"time"
+)
+
+func attributionTestEquity(t *testing.T, ticker string, sector string, held bool, values map[time.Time]float64, txns ...Transaction) *Equity {
+	equity, err := NewEquity(ticker, "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equity.Sector = sector
+	equity.CurrentlyHeld = held
+	for date, value := range values {
+		equity.ValueHistory[date.Unix()] = value
+	}
+	equity.transactions = txns
+	return equity
+}
+
+func TestCalculateAttributionGroupsGainsBySector(t *testing.T) {
+	start := time.Date(2023, time.December, 31, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, time.December, 31, 0, 0, 0, 0, time.UTC)
+	midYear := time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC)
+	sold := time.Date(2024, time.March, 2, 0, 0, 0, 0, time.UTC)
+	days := end.Sub(start).Hours() / 24
+	equities := []*Equity{
+		attributionTestEquity(t, "AAA", "Technology", true, map[time.Time]float64{start: 1000, end: 1200}),
+		attributionTestEquity(t, "BBB", "Energy", true, map[time.Time]float64{midYear: 1000, end: 900},
+			testTransaction("Buy", 10, 100, midYear.Add(12*time.Hour)),
+			testTransaction("Dividend", 50, 1, midYear.AddDate(0, 1, 0).Add(12*time.Hour))),
+		// The history of a closed position stops the day before its sale.
+		attributionTestEquity(t, "CCC", "Technology", false, map[time.Time]float64{start: 500, sold.AddDate(0, 0, -1): 600},
+			testTransaction("Sell", 5, 130, sold.Add(12*time.Hour))),
+	}
+
+	attribution := CalculateAttribution(equities, start, end)
+
+	techCapital := 1000 + 500 - 650*end.Sub(sold).Hours()/24/days
+	energyCapital := 1000 * end.Sub(midYear).Hours() / 24 / days
+	totalCapital := techCapital + energyCapital
+	requireFloat(t, attribution.Gain, 300)
+	requireFloat(t, attribution.Return, 300/totalCapital*100)
+	if len(attribution.Sectors) != 2 || attribution.Sectors[0].Name != "Technology" {
+		t.Fatalf("sectors = %#v", attribution.Sectors)
+	}
+	tech, energy := attribution.Sectors[0], attribution.Sectors[1]
+	requireFloat(t, tech.Gain, 350)
+	requireFloat(t, tech.Return, 350/techCapital*100)
+	requireFloat(t, energy.Gain, -50)
+	requireFloat(t, energy.Weight, energyCapital/totalCapital*100)
+	requireFloat(t, tech.Contribution+energy.Contribution, attribution.Return)
+	if len(tech.Equities) != 2 || len(attribution.EquityTypes) != 1 || attribution.Industries[0].Name != "Other" {
+		t.Fatalf("unexpected groups: %#v", attribution)
+	}
+}
+
+func TestCalculateAttributionValuesPositionSoldAfterPeriodEnd(t *testing.T) {
+	start := time.Date(2022, time.December, 31, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2023, time.December, 31, 0, 0, 0, 0, time.UTC)
+	lastClose := time.Date(2023, time.December, 29, 0, 0, 0, 0, time.UTC)
+	sold := time.Date(2024, time.January, 2, 12, 0, 0, 0, time.UTC)
+	equities := []*Equity{
+		attributionTestEquity(t, "CCC", "Technology", false, map[time.Time]float64{start: 500, lastClose: 600},
+			testTransaction("Sell", 5, 120, sold)),
+	}
+
+	attribution := CalculateAttribution(equities, start, end)
+
+	requireFloat(t, attribution.Gain, 100)
+	requireFloat(t, attribution.Return, 20)
+	// Worth nothing once sold, so the next year's gain is just the proceeds over the starting value.
+	requireFloat(t, CalculateAttribution(equities, end, end.AddDate(1, 0, 0)).Gain, 0)
+}
@@ -0,0 +1,148 @@
+package finance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+func TestNewBenchmarkNormalizesWeights(t *testing.T) {
+	benchmark, err := NewBenchmark("60/40", map[string]float64{"vt": 60, "BND": 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireFloat(t, benchmark.Weights["VT"], 0.6)
+	requireFloat(t, benchmark.Weights["BND"], 0.4)
+
+	if _, err := NewBenchmark("Bad", map[string]float64{"VT": -1}); err == nil {
+		t.Fatal("expected an error for a negative weight")
+	}
+	if _, err := NewBenchmark("Empty", nil); err == nil {
+		t.Fatal("expected an error for a benchmark without tickers")
+	}
+}
+
+func TestBuildHistoryRebalancesBlendOnCommonDates(t *testing.T) {
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	benchmark, err := NewBenchmark("60/40", map[string]float64{"VT": 0.6, "BND": 0.4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	benchmark.BuildHistory(map[string]data.Quote{
+		"VT":  {Date: []time.Time{day, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2)}, Close: []float64{100, 110, 121}},
+		"BND": {Date: []time.Time{day, day.AddDate(0, 0, 2)}, Close: []float64{50, 45}},
+	})
+
+	if len(benchmark.History.Date) != 2 {
+		t.Fatalf("blend history has %d dates, want 2", len(benchmark.History.Date))
+	}
+	requireFloat(t, benchmark.History.Close[0], 100)
+	// VT gains 21% and BND loses 10% between the common dates.
+	requireFloat(t, benchmark.History.Close[1], 100*(0.6*1.21+0.4*0.9))
+}
+
+func TestCompareBenchmarksUsesPortfolioDates(t *testing.T) {
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	benchmark, err := NewBenchmark("QQQ", map[string]float64{"QQQ": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	benchmark.BuildHistory(map[string]data.Quote{
+		"QQQ": {Date: []time.Time{day.AddDate(0, 0, -1), day, day.AddDate(0, 0, 1)}, Close: []float64{50, 100, 105}},
+	})
+	history := map[time.Time]float64{day: 1000, day.AddDate(0, 0, 1): 1100}
+
+	comparisons := CompareBenchmarks([]*Benchmark{benchmark}, history, CalculateTimeWeightedReturns(history, nil))
+
+	// The benchmark's earlier quote falls before the portfolio's first value, so is excluded.
+	requireFloat(t, comparisons["QQQ"].SinceInception, 5)
+	requireFloat(t, comparisons["QQQ"].ExcessSinceInception, 5)
+	requireFloat(t, comparisons["QQQ"].ExcessAnnual[2024], 5)
+}
+
+func TestCalculateTransactionDataComparesAgainstEachBenchmark(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bought := getUtcDate(time.Now().AddDate(0, 0, -10))
+	benchmark, err := NewBenchmark("QQQ", map[string]float64{"QQQ": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	benchmark.History = data.Quote{Date: []time.Time{bought, getUtcDate(time.Now())}, Close: []float64{100, 110}}
+	equity.benchmarks = []*Benchmark{benchmark}
+	equity.MarketPrice = 12
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 10, bought.Add(12*time.Hour)),
+		testTransaction("Sell", 5, 10, bought.Add(12*time.Hour)),
+	}
+
+	calculateTestTransactions(equity)
+
+	requireFloat(t, equity.transactions[0].BenchmarkReturns["QQQ"], 10)
+	requireFloat(t, equity.transactions[0].BenchmarkExcessReturns["QQQ"], 10)
+	// Selling avoided the benchmark's gain, which counts against the sale.
+	requireFloat(t, equity.transactions[1].BenchmarkReturns["QQQ"], -10)
+	requireFloat(t, equity.transactions[1].BenchmarkExcessReturns["QQQ"], -10)
+}
+
+func TestCalculateTransactionDataSignsOnlyBenchmarkReturns(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bought := getUtcDate(time.Now().AddDate(0, 0, -10))
+	benchmark, err := NewBenchmark("SPY", map[string]float64{"SPY": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	benchmark.History = data.Quote{Date: []time.Time{bought, getUtcDate(time.Now())}, Close: []float64{100, 110}}
+	equity.benchmarks = []*Benchmark{benchmark}
+	equity.sp500History = benchmark.History
+	equity.MarketPrice = 12
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 10, bought.Add(12*time.Hour)),
+		testTransaction("Sell", 5, 10, bought.Add(12*time.Hour)),
+	}
+
+	calculateTestTransactions(equity)
+
+	// The S&P 500 return keeps its original sign for both actions, while the benchmark returns are negated for a sale.
+	for _, txn := range equity.transactions {
+		requireFloat(t, txn.Sp500Return, -10)
+		requireFloat(t, txn.ExcessReturn, txn.TotalReturn-txn.Sp500Return)
+	}
+	requireFloat(t, equity.transactions[0].BenchmarkReturns["SPY"], 10)
+	requireFloat(t, equity.transactions[1].BenchmarkReturns["SPY"], -10)
+}
+
+func TestRetrieveBenchmarkHistoriesQueriesTickersAsConfigured(t *testing.T) {
+	store := newTestEmbeddedStore(t)
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	provider := &fakeMarketDataProvider{history: map[string]data.Quote{
+		"SPY": {Date: []time.Time{day}, Close: []float64{400}},
+		"QQQ": {Date: []time.Time{day}, Close: []float64{300}},
+	}}
+	benchmark, err := NewBenchmark("QQQ", map[string]float64{"QQQ": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalogue := NewEquityCatalogue("crypto", nil, store, provider)
+	catalogue.SetBenchmarks([]*Benchmark{benchmark})
+
+	catalogue.RetrieveBenchmarkHistories()
+
+	// Crypto tickers get a -USD suffix, but benchmarks don't.
+	if len(provider.historyQueried) != 2 || provider.historyQueried[0] != "SPY" || provider.historyQueried[1] != "QQQ" {
+		t.Fatalf("queried histories = %v", provider.historyQueried)
+	}
+	if len(catalogue.GetSp500().Close) != 1 || len(catalogue.GetBenchmarks()[0].History.Close) != 1 {
+		t.Fatalf("S&P 500 history = %#v, QQQ history = %#v", catalogue.GetSp500(), catalogue.GetBenchmarks()[0].History)
+	}
+	// The catalogue builds its own copy of the benchmark, leaving the shared one untouched.
+	if len(benchmark.History.Close) != 0 {
+		t.Fatalf("shared QQQ history = %#v", benchmark.History)
+	}
+}
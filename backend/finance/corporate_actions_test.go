@@ -0,0 +1,315 @@
+package finance
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+func TestCorporateActionRegistryAppliesSplitsDelistingsAndRenames(t *testing.T) {
+	splitDate := time.Date(2024, time.June, 10, 0, 0, 0, 0, time.UTC)
+	registry := NewCorporateActionRegistry([]data.CorporateAction{
+		{Ticker: "ACME", Type: data.CorporateActionSplit, Date: splitDate, Ratio: 4},
+		{Ticker: "GONE", Type: data.CorporateActionDelisting},
+		{Ticker: "OLD", Type: data.CorporateActionRename, Date: splitDate, NewTicker: "MID"},
+		{Ticker: "MID", Type: data.CorporateActionRename, Date: splitDate, NewTicker: "NEW"},
+		{Ticker: "LOOPA", Type: data.CorporateActionRename, Date: splitDate, NewTicker: "LOOPB"},
+		{Ticker: "LOOPB", Type: data.CorporateActionRename, Date: splitDate, NewTicker: "LOOPA"},
+	})
+
+	splits := registry.Splits("ACME")
+	if len(splits) != 1 || splits[0].Action != "Split" || !splits[0].DateTime.Equal(splitDate) {
+		t.Fatalf("unexpected split transactions: %#v", splits)
+	}
+	requireFloat(t, splits[0].Shares, 4)
+	// Callers get a copy, so the registry isn't modified by equity calculations.
+	splits[0].Shares = 1
+	requireFloat(t, registry.Splits("ACME")[0].Shares, 4)
+
+	if !registry.IsDelisted("GONE") || registry.IsDelisted("ACME") {
+		t.Fatal("only GONE should be delisted")
+	}
+	if registry.CurrentTicker("OLD") != "NEW" || registry.CurrentTicker("ACME") != "ACME" {
+		t.Fatalf("CurrentTicker(OLD) = %s, want NEW", registry.CurrentTicker("OLD"))
+	}
+	// A rename loop should terminate.
+	registry.CurrentTicker("LOOPA")
+}
+
+func TestProcessImportTracksRenamedTickerUnderNewSymbol(t *testing.T) {
+	SetCorporateActions(append([]data.CorporateAction{{Ticker: "FB", Type: data.CorporateActionRename,
+		Date: time.Date(2022, time.June, 9, 0, 0, 0, 0, time.UTC), NewTicker: "META"}}, DefaultCorporateActions...))
+	t.Cleanup(func() { SetCorporateActions(DefaultCorporateActions) })
+
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/3/2022", "FB", "Buy", "2", "300", "Stock"},
+		{"1/3/2023", "META", "Buy", "1", "125", "Stock"},
+	})
+
+	if _, ok := catalogue.equities["FB"]; ok {
+		t.Fatal("FB transactions should be tracked under META")
+	}
+	if len(catalogue.equities["META"].transactions) != 2 {
+		t.Fatalf("META transactions = %d, want 2", len(catalogue.equities["META"].transactions))
+	}
+}
+
+func TestRetrieveSplitHistoryQueriesListedEquities(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFixture(t, filepath.Join(dir, "splits", "ACME.csv"), "Date,Ratio\n2022-07-18,20\n2024-01-02,0.1\n")
+	catalogue := NewEquityCatalogue("stock", nil, nil, NewFileMarketDataProvider(dir))
+	catalogue.ProcessImport([][]interface{}{
+		{"1/3/2022", "ACME", "Buy", "2", "300", "Stock"},
+		{"1/3/2022", "OTHER", "Buy", "2", "300", "Stock"},
+		{"1/3/2022", "XLNX", "Buy", "2", "300", "Stock"},
+	})
+
+	splits := catalogue.RetrieveSplitHistory()
+
+	if len(splits) != 2 {
+		t.Fatalf("splits = %d, want 2", len(splits))
+	}
+	if splits[0].Ticker != "ACME" || !splits[0].Date.Equal(time.Date(2022, time.July, 18, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected split: %#v", splits[0])
+	}
+	requireFloat(t, splits[1].Ratio, 0.1)
+}
+
+func TestRetrievedSplitOnExDateDoesNotDuplicateKnownSplit(t *testing.T) {
+	t.Cleanup(func() { SetCorporateActions(DefaultCorporateActions) })
+	store := newTestEmbeddedStore(t)
+	for idx := range DefaultCorporateActions {
+		action := DefaultCorporateActions[idx]
+		if err := store.InsertCorporateAction(&action); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The provider dates the 2024 split on its ex-date, rather than the built-in announced date of June 7th.
+	dir := t.TempDir()
+	writeTestFixture(t, filepath.Join(dir, "splits", "NVDA.csv"), "Date,Ratio\n2021-07-20,4\n2024-06-10,10\n")
+	catalogue := NewEquityCatalogue("stock", nil, store, NewFileMarketDataProvider(dir))
+	catalogue.ProcessImport([][]interface{}{{"1/2/2020", "NVDA", "Buy", "1", "100", "Stock"}})
+
+	for _, split := range catalogue.RetrieveSplitHistory() {
+		if inserted, err := store.InsertCorporateActionIfMissing(&split); err != nil || inserted {
+			t.Fatalf("split on %v inserted = %v, %v", split.Date, inserted, err)
+		}
+	}
+	actions, err := store.GetCorporateActions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCorporateActions(actions)
+
+	equity, err := NewEquity("NVDA", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 1, 100, time.Date(2020, time.January, 2, 12, 0, 0, 0, time.UTC)),
+	}
+	stockData := map[string]interface{}{
+		"NVDA": map[string]interface{}{"currentPrice": 100.0, "previousClose": 100.0},
+	}
+	equity.PreProcess(fakeRevenueDataProvider{}, &stockData)
+
+	requireFloat(t, calculateTestTransactions(equity), 40)
+}
+
+func TestApplyMergersConvertsLotsToAcquirerSharesAndCash(t *testing.T) {
+	mergerDate := time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC)
+	SetCorporateActions([]data.CorporateAction{{Ticker: "OLD", Type: data.CorporateActionMerger, Date: mergerDate,
+		NewTicker: "NEW", Ratio: 2, CashPerShare: 5, BasisAllocation: 0.75}})
+	t.Cleanup(func() { SetCorporateActions(DefaultCorporateActions) })
+
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/3/2022", "OLD", "Buy", "10", "20", "Stock"},
+		{"3/1/2024", "OLD", "Buy", "10", "40", "Stock"},
+		{"4/1/2024", "OLD", "Sell", "5", "30", "Stock"},
+		{"7/1/2024", "NEW", "Sell", "10", "10", "Stock"},
+	})
+	catalogue.ApplyShareConversions()
+	// Applying the mergers again shouldn't convert the shares twice.
+	catalogue.ApplyShareConversions()
+
+	old, acquirer := catalogue.equities["OLD"], catalogue.equities["NEW"]
+	if !old.merged || !skipMarketData("OLD") {
+		t.Fatal("OLD should be marked as merged")
+	}
+	for _, equity := range []*Equity{old, acquirer} {
+		equity.PreProcess(fakeRevenueDataProvider{}, &map[string]interface{}{})
+		calculateTestTransactions(equity)
+	}
+	if len(old.transactions) != 4 || old.transactions[3].Action != "Merger" {
+		t.Fatalf("expected a single merger transaction on OLD: %#v", old.transactions)
+	}
+	requireFloat(t, old.transactions[3].Shares, 15)
+	// The sale realizes (30-20)*5, then the cash portion realizes 5/share against 25% of each lot's basis.
+	requireFloat(t, old.RealizedGain, 50+(5-5)*5+(5-10)*10)
+	if len(old.buyQ) != 0 || old.CurrentlyHeld {
+		t.Fatal("OLD should have no open lots after the merger")
+	}
+	cashLot := old.closedLots[1]
+	if !cashLot.LongTerm || !cashLot.DateSold.Equal(mergerDate) {
+		t.Fatalf("unexpected closed lot for cash portion: %#v", cashLot)
+	}
+
+	// Received lots keep their original acquisition date, with 75% of the basis.
+	requireFloat(t, acquirer.RealizedGain, (10-7.5)*10)
+	if len(acquirer.closedLots) != 1 || !acquirer.closedLots[0].LongTerm ||
+		!acquirer.closedLots[0].DateAcquired.Equal(time.Date(2022, time.January, 3, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected closed lot for acquirer sale: %#v", acquirer.closedLots)
+	}
+	if len(acquirer.buyQ) != 1 || !acquirer.CurrentlyHeld {
+		t.Fatalf("acquirer open lots = %d, want 1", len(acquirer.buyQ))
+	}
+	requireFloat(t, acquirer.buyQ[0].Shares, 20)
+	requireFloat(t, acquirer.buyQ[0].Price, 15)
+
+	// The cash portion is added to the cash balance.
+	catalogue.CalculateCashBalanceHistory()
+	requireFloat(t, catalogue.equities["CASH"].MarketValue, -200-400+150+75+100)
+}
+
+func TestApplyMergersClosesCashAcquisition(t *testing.T) {
+	SetCorporateActions([]data.CorporateAction{{Ticker: "OLD", Type: data.CorporateActionMerger,
+		Date: time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC), CashPerShare: 25}})
+	t.Cleanup(func() { SetCorporateActions(DefaultCorporateActions) })
+
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/3/2024", "OLD", "Buy", "10", "20", "Stock"},
+	})
+	catalogue.ApplyShareConversions()
+
+	old := catalogue.equities["OLD"]
+	if len(catalogue.equities) != 1 {
+		t.Fatalf("equities = %d, want only OLD", len(catalogue.equities))
+	}
+	if calculateTestTransactions(old) != 0 {
+		t.Fatal("OLD should have no shares after the acquisition")
+	}
+	requireFloat(t, old.RealizedGain, (25-20)*10)
+}
+
+func TestDefaultMatterportMergerRealizesCashAndMovesLotsToCoStar(t *testing.T) {
+	SetCorporateActions(DefaultCorporateActions)
+
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	catalogue.ProcessImport([][]interface{}{
+		{"3/1/2022", "MTTR", "Buy", "100", "4", "Stock"},
+	})
+	catalogue.ApplyShareConversions()
+
+	mttr, csgp := catalogue.equities["MTTR"], catalogue.equities["CSGP"]
+	if !mttr.merged || csgp == nil {
+		t.Fatal("MTTR should be merged into CSGP")
+	}
+	for _, equity := range []*Equity{mttr, csgp} {
+		equity.PreProcess(fakeRevenueDataProvider{}, &map[string]interface{}{})
+	}
+	if calculateTestTransactions(mttr) != 0 {
+		t.Fatal("MTTR should have no shares after the merger")
+	}
+	// The $2.75 per share in cash realizes a gain against half of the basis.
+	requireFloat(t, mttr.RealizedGain, 2.75*100-200)
+	if len(mttr.closedLots) != 1 || !mttr.closedLots[0].LongTerm ||
+		!mttr.closedLots[0].DateSold.Equal(time.Date(2025, time.February, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected closed lots for MTTR: %#v", mttr.closedLots)
+	}
+
+	requireFloat(t, calculateTestTransactions(csgp), 3)
+	if len(csgp.buyQ) != 1 {
+		t.Fatalf("CSGP open lots = %d, want 1", len(csgp.buyQ))
+	}
+	requireFloat(t, csgp.buyQ[0].Shares*csgp.buyQ[0].Price, 200)
+}
+
+func TestApplySpinOffMovesBasisToNewCompany(t *testing.T) {
+	SetCorporateActions([]data.CorporateAction{{Ticker: "PARENT", Type: data.CorporateActionSpinOff,
+		Date: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC), NewTicker: "CHILD", Ratio: 0.5, BasisAllocation: 0.2}})
+	t.Cleanup(func() { SetCorporateActions(DefaultCorporateActions) })
+
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/3/2023", "PARENT", "Buy", "10", "100", "Stock"},
+		{"3/1/2024", "PARENT", "Sell", "4", "90", "Stock"},
+		{"3/1/2024", "CHILD", "Sell", "1", "50", "Stock"},
+	})
+	catalogue.ApplyShareConversions()
+
+	parent, child := catalogue.equities["PARENT"], catalogue.equities["CHILD"]
+	for _, equity := range []*Equity{parent, child} {
+		equity.PreProcess(fakeRevenueDataProvider{}, &map[string]interface{}{})
+		calculateTestTransactions(equity)
+	}
+	// The parent keeps its shares, with 80% of the basis.
+	requireFloat(t, parent.RealizedGain, (90-80)*4)
+	if len(parent.buyQ) != 1 || !parent.CurrentlyHeld {
+		t.Fatalf("parent open lots = %d, want 1", len(parent.buyQ))
+	}
+	requireFloat(t, parent.buyQ[0].Shares, 6)
+	requireFloat(t, parent.buyQ[0].Price, 80)
+
+	// The new company's shares get 20% of the basis, and the parent's holding period.
+	requireFloat(t, child.RealizedGain, 50-40)
+	if len(child.closedLots) != 1 || !child.closedLots[0].LongTerm {
+		t.Fatalf("spun-off shares should keep the parent's holding period: %#v", child.closedLots)
+	}
+	requireFloat(t, child.buyQ[0].Shares, 4)
+	requireFloat(t, child.buyQ[0].Price, 40)
+}
+
+func TestApplyMergersValuesMovedSharesAtMarketPrice(t *testing.T) {
+	mergerDate := time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC)
+	SetCorporateActions([]data.CorporateAction{{Ticker: "OLD", Type: data.CorporateActionMerger, Date: mergerDate,
+		NewTicker: "NEW", Ratio: 2}})
+	t.Cleanup(func() { SetCorporateActions(DefaultCorporateActions) })
+	store := newTestEmbeddedStore(t)
+	provider := &fakeMarketDataProvider{history: map[string]data.Quote{
+		"NEW": {Date: []time.Time{mergerDate}, Close: []float64{15}},
+	}}
+
+	catalogue := NewEquityCatalogue("stock", nil, store, provider)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/3/2022", "OLD", "Buy", "10", "20", "Stock"},
+		{"7/1/2024", "NEW", "Sell", "20", "16", "Stock"},
+	})
+	catalogue.ApplyShareConversions()
+
+	old, acquirer := catalogue.equities["OLD"], catalogue.equities["NEW"]
+	for _, equity := range []*Equity{old, acquirer} {
+		equity.PreProcess(fakeRevenueDataProvider{}, &map[string]interface{}{})
+		calculateTestTransactions(equity)
+	}
+	// OLD gained up to the merger, at NEW's price, and NEW only gained after it.
+	bought := time.Date(2022, time.January, 3, 12, 0, 0, 0, time.UTC)
+	sold := time.Date(2024, time.July, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		equity *Equity
+		flows  []CashFlow
+		want   float64
+	}{
+		{old, []CashFlow{{bought, -200}, {mergerDate, 300}}, math.Pow(1.5, 365/mergerDate.Sub(bought).Hours()*24) - 1},
+		{acquirer, []CashFlow{{mergerDate, -300}, {sold, 320}}, math.Pow(320.0/300, 365/sold.Sub(mergerDate).Hours()*24) - 1},
+	} {
+		flows := tc.equity.GetInvestmentCashFlows()
+		if len(flows) != len(tc.flows) {
+			t.Fatalf("%s flows = %#v", tc.equity.Ticker, flows)
+		}
+		for i := range flows {
+			if !flows[i].Date.Equal(tc.flows[i].Date) {
+				t.Fatalf("%s flows = %#v", tc.equity.Ticker, flows)
+			}
+			requireFloat(t, flows[i].Amount, tc.flows[i].Amount)
+		}
+		if got := CalculateMoneyWeightedReturn(flows, 0, sold); math.Abs(got-tc.want*100) > 0.01 {
+			t.Fatalf("%s money-weighted return = %f, want %f", tc.equity.Ticker, got, tc.want*100)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package finance
+
+import (
+	"testing"
+	"time"
+)
+
+func newLotTestEquity(t *testing.T, method string, sale Transaction) *Equity {
+	t.Helper()
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = equity.SetCostBasisMethod(method); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, time.January, 2, 12, 0, 0, 0, time.UTC)
+	first := testTransaction("Buy", 10, 10, date)
+	first.LotId = "A"
+	second := testTransaction("Buy", 10, 30, date.AddDate(0, 2, 0))
+	second.LotId = "B"
+	third := testTransaction("Buy", 10, 20, date.AddDate(0, 4, 0))
+	third.LotId = "C"
+	// Sell outside the wash sale window of every purchase.
+	sale.DateTime = date.AddDate(0, 6, 0)
+	equity.transactions = []Transaction{first, second, third, sale}
+	shares := 0.0
+	for idx := range equity.transactions {
+		shares = equity.CalculateTransactionData(idx, shares)
+	}
+	requireFloat(t, shares, 30-sale.Shares)
+	return equity
+}
+
+func TestCostBasisMethodsSelectLots(t *testing.T) {
+	testCases := []struct {
+		method       string
+		realizedGain float64
+		remaining    []float64
+	}{
+		{method: CostBasisFIFO, realizedGain: 15*25 - (10*10 + 5*30), remaining: []float64{5, 10}},
+		{method: CostBasisLIFO, realizedGain: 15*25 - (10*20 + 5*30), remaining: []float64{10, 5}},
+		{method: CostBasisHIFO, realizedGain: 15*25 - (10*30 + 5*20), remaining: []float64{10, 5}},
+		{method: CostBasisAverage, realizedGain: 15 * (25 - 20), remaining: []float64{5, 5, 5}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method, func(t *testing.T) {
+			equity := newLotTestEquity(t, tc.method, testTransaction("Sell", 15, 25, time.Time{}))
+
+			requireFloat(t, equity.RealizedGain, tc.realizedGain)
+			if len(equity.buyQ) != len(tc.remaining) {
+				t.Fatalf("remaining lots = %d, want %d", len(equity.buyQ), len(tc.remaining))
+			}
+			for idx, shares := range tc.remaining {
+				requireFloat(t, equity.buyQ[idx].Shares, shares)
+			}
+		})
+	}
+}
+
+func TestCostBasisAverageKeepsUnitCostBasis(t *testing.T) {
+	equity := newLotTestEquity(t, CostBasisAverage, testTransaction("Sell", 12, 25, time.Time{}))
+
+	totalShares, totalCost := 0.0, 0.0
+	for _, lot := range equity.buyQ {
+		totalShares += lot.Shares
+		totalCost += lot.Shares * lot.Price
+	}
+	requireFloat(t, totalShares, 18)
+	requireFloat(t, totalCost/totalShares, 20)
+}
+
+func TestCostBasisSpecificLotAndSaleOverride(t *testing.T) {
+	sale := testTransaction("Sell", 15, 25, time.Time{})
+	sale.LotId = "C"
+	equity := newLotTestEquity(t, CostBasisSpecificLot, sale)
+
+	// Lot C is sold first, then the remainder falls back to FIFO.
+	requireFloat(t, equity.RealizedGain, 15*25-(10*20+5*10))
+	if equity.findLot("C") != -1 {
+		t.Fatal("lot C should be fully sold")
+	}
+
+	sale = testTransaction("Sell", 5, 25, time.Time{})
+	sale.CostBasisMethod = CostBasisHIFO
+	equity = newLotTestEquity(t, CostBasisFIFO, sale)
+	requireFloat(t, equity.RealizedGain, 5*(25-30))
+}
+
+func TestSetCostBasisMethodRejectsUnknownMethod(t *testing.T) {
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	if err := catalogue.SetCostBasisMethod("Random"); err == nil {
+		t.Fatal("unknown cost basis method should be rejected")
+	}
+	if err := catalogue.SetCostBasisMethod(CostBasisLIFO); err != nil {
+		t.Fatal(err)
+	}
+	catalogue.ProcessImport([][]interface{}{
+		{"1/2/2024", "ACME", "Buy", "10", "12.50", "Stock", "", "LOT1"},
+		{"1/3/2024", "ACME", "Sell", "2", "15", "Stock", "", "LOT1", "HIFO"},
+	})
+
+	equity := catalogue.equities["ACME"]
+	if equity.costBasisMethod != CostBasisLIFO {
+		t.Fatalf("equity cost basis method = %q, want %q", equity.costBasisMethod, CostBasisLIFO)
+	}
+	if equity.transactions[0].LotId != "LOT1" || equity.transactions[1].CostBasisMethod != CostBasisHIFO {
+		t.Fatalf("optional columns not parsed: %#v", equity.transactions)
+	}
+}
@@ -0,0 +1,51 @@
+package finance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+func diversificationTestEquity(t *testing.T, ticker string, marketValue float64, start time.Time, closes ...float64) *Equity {
+	equity, err := NewEquity(ticker, "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equity.CurrentlyHeld = true
+	equity.MarketValue = marketValue
+	equity.priceHistory = data.Quote{Symbol: ticker}
+	for idx, close := range closes {
+		equity.priceHistory.Date = append(equity.priceHistory.Date, start.AddDate(0, 0, idx))
+		equity.priceHistory.Close = append(equity.priceHistory.Close, close)
+	}
+	return equity
+}
+
+func TestCalculateDiversificationCorrelatesHoldings(t *testing.T) {
+	end := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	start := end.AddDate(0, 0, -4)
+	sold, _ := NewEquity("OLD", "Stock")
+	equities := []*Equity{
+		diversificationTestEquity(t, "AAA", 500, start, 100, 110, 99, 108.9, 119.79),
+		// Moves with AAA, with twice the returns.
+		diversificationTestEquity(t, "BBB", 300, start, 50, 60, 48, 57.6, 69.12),
+		// Moves against AAA. The early close is outside the lookback.
+		diversificationTestEquity(t, "CCC", 200, start.AddDate(0, 0, -1), 10, 20, 18, 19.8, 17.82, 16.038),
+		sold,
+	}
+
+	report := CalculateDiversification(equities, 4, 2, end)
+
+	if len(report.Tickers) != 3 || report.Tickers[0] != "AAA" || report.Tickers[2] != "CCC" {
+		t.Fatalf("tickers = %v", report.Tickers)
+	}
+	requireFloat(t, report.Correlations[0][0], 1)
+	requireFloat(t, report.Correlations[0][1], 1)
+	requireFloat(t, report.Correlations[1][0], 1)
+	requireFloat(t, report.Correlations[0][2], -1)
+	requireFloat(t, report.Holdings[0].Weight, 50)
+	requireFloat(t, report.TopWeight, 80)
+	requireFloat(t, report.Herfindahl, 0.25+0.09+0.04)
+	requireFloat(t, report.EffectiveHoldings, 1/0.38)
+}
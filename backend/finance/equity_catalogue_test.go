@@ -3,10 +3,12 @@ package finance
 import (
 	"testing"
 	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
 )
 
 func TestProcessImportGroupsTransactionsByTicker(t *testing.T) {
-	catalogue := NewEquityCatalogue("stock", nil, nil, "")
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
 	catalogue.ProcessImport([][]interface{}{
 		{"1/2/2024", "ACME", "Buy", "10", "12.50", "Stock"},
 		{"1/3/2024", "ACME", "Sell", "2", "15", "Stock"},
@@ -29,7 +31,7 @@ func TestProcessImportGroupsTransactionsByTicker(t *testing.T) {
 }
 
 func TestCalculateCashBalanceHistoryOrdersAndClassifiesTransactions(t *testing.T) {
-	catalogue := NewEquityCatalogue("stock", nil, nil, "")
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
 	catalogue.ProcessImport([][]interface{}{
 		{"1/3/2024", "CASH", "Deposit", "1000", "", "Cash"},
 		{"1/1/2024", "ACME", "Buy", "10", "10", "Stock"},
@@ -52,7 +54,7 @@ func TestCalculateCashBalanceHistoryOrdersAndClassifiesTransactions(t *testing.T
 }
 
 func TestAccumulateValueHistoryCombinesPositiveDailyValues(t *testing.T) {
-	catalogue := NewEquityCatalogue("stock", nil, nil, "")
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
 	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
 	catalogue.PortfolioHistory[day] = 10
 
@@ -70,7 +72,7 @@ func TestAccumulateValueHistoryCombinesPositiveDailyValues(t *testing.T) {
 }
 
 func TestCalculatePortfolioSummaryMetricsAggregatesEquitiesAndCash(t *testing.T) {
-	catalogue := NewEquityCatalogue("stock", nil, nil, "")
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
 	currentYear := time.Now().Year()
 	historyDay := time.Date(currentYear, time.January, 2, 0, 0, 0, 0, time.UTC)
 	stock, err := NewEquity("ACME", "Stock")
@@ -107,7 +109,7 @@ func TestCalculatePortfolioSummaryMetricsAggregatesEquitiesAndCash(t *testing.T)
 }
 
 func TestCalculateCashBalanceHistoryCreatesMissingCashEquity(t *testing.T) {
-	catalogue := NewEquityCatalogue("stock", nil, nil, "")
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
 	stock, err := NewEquity("ACME", "Stock")
 	if err != nil {
 		t.Fatal(err)
@@ -125,3 +127,72 @@ func TestCalculateCashBalanceHistoryCreatesMissingCashEquity(t *testing.T) {
 	}
 	requireFloat(t, cash.MarketValue, -20)
 }
+
+type fakeMarketDataProvider struct {
+	tickerData map[string]interface{}
+	history    map[string]data.Quote
+	queried    []string
+	// Tickers whose history was queried.
+	historyQueried []string
+}
+
+func (f *fakeMarketDataProvider) GetTickerData(tickers string) *map[string]interface{} {
+	f.queried = append(f.queried, tickers)
+	result := make(map[string]interface{})
+	if val, ok := f.tickerData[tickers]; ok {
+		result[tickers] = val
+	}
+	return &result
+}
+
+func (f *fakeMarketDataProvider) GetHistoricalData(ticker string, startDate string, endDate string) (*data.Quote, error) {
+	f.historyQueried = append(f.historyQueried, ticker)
+	quote := f.history[ticker]
+	quote.Symbol = ticker
+	return &quote, nil
+}
+
+func TestRetrieveQuoteDataSkipsDelistedAndAppendsCryptoSuffix(t *testing.T) {
+	provider := &fakeMarketDataProvider{tickerData: map[string]interface{}{
+		"BTC-USD": map[string]interface{}{"previousClose": 50000.0},
+	}}
+	catalogue := NewEquityCatalogue("crypto", nil, nil, provider)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/2/2024", "BTC", "Buy", "1", "40000", "Crypto"},
+		{"1/2/2024", "ETH", "Buy", "1", "2000", "Crypto"},
+		{"1/3/2024", "CASH", "Deposit", "100", "", "Cash"},
+	})
+
+	stockData := catalogue.RetrieveQuoteData()
+
+	if len(provider.queried) != 2 {
+		t.Fatalf("queried tickers = %v, want BTC-USD and ETH-USD only", provider.queried)
+	}
+	if len(stockData) != 1 {
+		t.Fatalf("stock data entries = %d, want 1", len(stockData))
+	}
+	if _, ok := stockData["BTC-USD"]; !ok {
+		t.Fatal("BTC-USD data should be keyed by the provider ticker")
+	}
+}
+
+func TestCalculateCashBalanceHistoryAppliesIncomeAndFees(t *testing.T) {
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/1/2024", "CASH", "Deposit", "1000", "", "Cash"},
+		{"1/2/2024", "ACME", "Buy", "10", "50", "Stock"},
+		{"1/3/2024", "ACME", "Dividend", "20", "", "Stock"},
+		{"1/4/2024", "ACME", "ReinvestedDividend", "0.5", "40", "Stock"},
+		{"1/5/2024", "CASH", "Interest", "7", "", "Cash"},
+		{"1/6/2024", "CASH", "Fee", "2", "", "Cash"},
+	})
+
+	catalogue.CalculateCashBalanceHistory()
+	cash := catalogue.equities["CASH"]
+
+	requireFloat(t, cash.MarketValue, 1000-500+20+7-2)
+	requireFloat(t, cash.IncomeReceived, 7)
+	requireFloat(t, cash.FeesPaid, 2)
+	// Income is not an external cash flow.
+	requireFloat(t, catalogue.CashFlowByYear[2024], 1000)
+}
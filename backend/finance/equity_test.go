@@ -82,7 +82,7 @@ func TestCalculateTransactionDataAdjustsLotsForStockSplit(t *testing.T) {
 	requireFloat(t, equity.buyQ[0].Price, 50)
 }
 
-func TestCalculateTransactionDataAccountsForOversoldShares(t *testing.T) {
+func TestCalculateTransactionDataFlagsOversoldShares(t *testing.T) {
 	equity, err := NewEquity("ACME", "Stock")
 	if err != nil {
 		t.Fatal(err)
@@ -93,7 +93,11 @@ func TestCalculateTransactionDataAccountsForOversoldShares(t *testing.T) {
 
 	shares := equity.CalculateTransactionData(0, 0)
 	requireFloat(t, shares, 0)
-	requireFloat(t, equity.RealizedGain, 60)
+	// The oversold shares have no lot, so no gain is realized on them.
+	requireFloat(t, equity.RealizedGain, 0)
+	if equity.transactions[0].Error == "" || len(equity.closedLots) != 0 {
+		t.Fatalf("oversold sale = %#v, closed lots = %#v", equity.transactions[0], equity.closedLots)
+	}
 }
 
 func TestCalculateMetricsBuildsValuesAndHoldingMetrics(t *testing.T) {
@@ -246,35 +250,6 @@ func (f fakeRevenueDataProvider) GetAllRevenueData(ticker string) *sheets.ValueR
 	return f.values[ticker]
 }
 
-func TestGetQuoteOfSP500HandlesExactWeekendAndMissingHistory(t *testing.T) {
-	equity, err := NewEquity("ACME", "Stock")
-	if err != nil {
-		t.Fatal(err)
-	}
-	friday := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)
-	monday := friday.AddDate(0, 0, 3)
-	equity.sp500History = data.Quote{Date: []time.Time{friday, monday}, Close: []float64{100, 105}}
-
-	requireFloat(t, equity.GetQuoteOfSP500(friday), 100)
-	requireFloat(t, equity.GetQuoteOfSP500(friday.AddDate(0, 0, 1)), 100)
-
-	equity.sp500History = data.Quote{}
-	requireFloat(t, equity.GetQuoteOfSP500(friday), 0)
-}
-
-func TestGetQuoteOfSP500UsesLatestQuoteForToday(t *testing.T) {
-	equity, err := NewEquity("ACME", "Stock")
-	if err != nil {
-		t.Fatal(err)
-	}
-	equity.sp500History = data.Quote{
-		Date:  []time.Time{getUtcDate(time.Now().AddDate(0, 0, -1))},
-		Close: []float64{123},
-	}
-
-	requireFloat(t, equity.GetQuoteOfSP500(time.Now()), 123)
-}
-
 func TestCalculateMetricsSkipsForwardPriceToSalesForZeroEstimate(t *testing.T) {
 	equity, err := NewEquity("ACME", "Stock")
 	if err != nil {
@@ -370,3 +345,112 @@ func TestPreProcessAddsKnownStockSplits(t *testing.T) {
 	}
 	requireFloat(t, equity.splitMultiple, 40)
 }
+
+func TestCalculateTransactionDataTracksIncomeAndReinvestedLots(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, time.January, 2, 12, 0, 0, 0, time.UTC)
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 10, date),
+		testTransaction("Dividend", 5, 1, date.AddDate(0, 0, 1)),
+		testTransaction("ReinvestedDividend", 0.5, 12, date.AddDate(0, 0, 2)),
+		testTransaction("Fee", 2, 1, date.AddDate(0, 0, 3)),
+		testTransaction("Sell", 10.5, 20, date.AddDate(0, 0, 4)),
+	}
+
+	shares := 0.0
+	for idx := range equity.transactions {
+		shares = equity.CalculateTransactionData(idx, shares)
+	}
+
+	requireFloat(t, shares, 0)
+	requireFloat(t, equity.IncomeReceived, 11)
+	requireFloat(t, equity.FeesPaid, 2)
+	// The reinvested lot covers the extra half share, so nothing is treated as oversold.
+	requireFloat(t, equity.RealizedGain, 100+4)
+	if len(equity.buyQ) != 0 {
+		t.Fatalf("remaining buy lots = %d, want 0", len(equity.buyQ))
+	}
+}
+
+func TestCalculateTransactionDataAppliesTradeFeesToLots(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, time.January, 2, 12, 0, 0, 0, time.UTC)
+	equity.transactions = []Transaction{
+		testTransaction("Fee", 5, 1, date),
+		testTransaction("Buy", 10, 10, date),
+		testTransaction("Fee", 2, 1, date.AddDate(0, 0, 1)),
+		testTransaction("Sell", 5, 20, date.AddDate(0, 0, 2)),
+		testTransaction("Fee", 3, 1, date.AddDate(0, 0, 2)),
+	}
+
+	equity.resetCalculatedMetrics()
+	requireFloat(t, calculateTestTransactions(equity), 5)
+
+	// The buy fee adds to the lot's basis, and the sale fee comes out of its proceeds.
+	if len(equity.closedLots) != 1 || len(equity.buyQ) != 1 {
+		t.Fatalf("closed lots = %d, open lots = %d, want 1 each", len(equity.closedLots), len(equity.buyQ))
+	}
+	requireFloat(t, equity.closedLots[0].Proceeds, 5*20-3)
+	requireFloat(t, equity.closedLots[0].CostBasis, 5*10.5)
+	requireFloat(t, equity.RealizedGain, 97-52.5)
+	requireFloat(t, equity.buyQ[0].Price, 10.5)
+	// Only the fee not paid on a trade is counted separately.
+	requireFloat(t, equity.FeesPaid, 2)
+}
+
+func TestCalculateMetricsIncludesIncomeInTotalGain(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	friday := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)
+	monday := friday.AddDate(0, 0, 3)
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 10, friday.Add(12*time.Hour)),
+		testTransaction("Dividend", 3, 1, monday.Add(12*time.Hour)),
+		testTransaction("Buy", 10, 10, monday.Add(12*time.Hour)),
+	}
+	equity.MarketPrice = 10
+	equity.CurrentlyHeld = true
+	today := getUtcDate(time.Now())
+
+	equity.CalculateMetrics(
+		data.Quote{Date: []time.Time{friday, monday}, Close: []float64{10, 10}},
+		data.Quote{Date: []time.Time{friday, today}, Close: []float64{100, 110}},
+	)
+
+	requireFloat(t, equity.NumShares, 20)
+	requireFloat(t, equity.IncomeReceived, 3)
+	requireFloat(t, equity.TotalGain, 3)
+	requireFloat(t, equity.ValueHistory[monday.Unix()], 200)
+}
+
+func TestPreProcessSavesSectorOfClosedStocks(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2023, time.January, 3, 12, 0, 0, 0, time.UTC)
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 10, day),
+		testTransaction("Sell", 10, 12, day.AddDate(0, 3, 0)),
+	}
+	stockData := map[string]interface{}{
+		"ACME": map[string]interface{}{"currentPrice": 15.0, "sector": "Technology", "industry": "Software"},
+	}
+
+	equity.PreProcess(fakeRevenueDataProvider{}, &stockData)
+
+	if equity.CurrentlyHeld {
+		t.Fatal("equity should not be currently held")
+	}
+	if equity.Sector != "Technology" || equity.Industry != "Software" {
+		t.Fatalf("sector = %q, industry = %q", equity.Sector, equity.Industry)
+	}
+}
@@ -0,0 +1,103 @@
+package finance
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/config"
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+func writeTestFixture(t *testing.T, fileName string, contents string) {
+	t.Helper()
+	if err := writeFixtureFile(fileName, []byte(contents)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileMarketDataProviderServesFixtures(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFixture(t, filepath.Join(dir, "info", "ACME.json"), `{"currentPrice": 12.5, "sector": "Technology"}`)
+	writeTestFixture(t, filepath.Join(dir, "history", "ACME.csv"),
+		"Date,Open,High,Low,Close,Volume\n"+
+			"2024-01-02 00:00:00-05:00,10,11,9,10.5,100\n"+
+			"2024-01-03,10.5,12,10,11.5,200\n"+
+			"2024-01-04,11.5,13,11,12.5,300\n")
+	provider := NewFileMarketDataProvider(dir)
+
+	result := provider.GetTickerData("ACME,MISSING")
+	if len(*result) != 1 {
+		t.Fatalf("ticker data entries = %d, want 1", len(*result))
+	}
+	info := (*result)["ACME"].(map[string]interface{})
+	requireFloat(t, info["currentPrice"].(float64), 12.5)
+
+	quote, err := provider.GetHistoricalData("ACME", "2024-01-02", "2024-01-04")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quote.Date) != 2 {
+		t.Fatalf("bars = %d, want 2 (end date is exclusive)", len(quote.Date))
+	}
+	if !quote.Date[0].Equal(time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Date[0] = %v, want 2024-01-02 UTC", quote.Date[0])
+	}
+	requireFloat(t, quote.Close[1], 11.5)
+	requireFloat(t, quote.Volume[1], 200)
+
+	if _, err = provider.GetHistoricalData("MISSING", "2024-01-02", "2024-01-04"); err == nil {
+		t.Fatal("missing history fixture should return an error")
+	}
+}
+
+func TestRecordingMarketDataProviderWritesReplayableFixtures(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	source := &fakeMarketDataProvider{
+		tickerData: map[string]interface{}{"ACME": map[string]interface{}{"currentPrice": 20.0}},
+		history: map[string]data.Quote{"ACME": {
+			Date:  []time.Time{day.AddDate(0, 0, 1), day},
+			Close: []float64{21, 20},
+		}},
+	}
+	recorder := NewRecordingMarketDataProvider(source, dir)
+
+	recorder.GetTickerData("ACME")
+	if _, err := recorder.GetHistoricalData("ACME", "2024-01-02", "2024-01-04"); err != nil {
+		t.Fatal(err)
+	}
+	// Record an overlapping fetch, which should not duplicate the existing bar.
+	source.history["ACME"] = data.Quote{Date: []time.Time{day.AddDate(0, 0, 1)}, Close: []float64{22}}
+	if _, err := recorder.GetHistoricalData("ACME", "2024-01-03", "2024-01-04"); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := NewFileMarketDataProvider(dir)
+	info := (*replay.GetTickerData("ACME"))["ACME"].(map[string]interface{})
+	requireFloat(t, info["currentPrice"].(float64), 20)
+	quote, err := replay.GetHistoricalData("ACME", "2024-01-01", "2024-01-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quote.Date) != 2 || !quote.Date[0].Equal(day) {
+		t.Fatalf("replayed dates = %v, want two sorted dates starting %v", quote.Date, day)
+	}
+	requireFloat(t, quote.Close[0], 20)
+	requireFloat(t, quote.Close[1], 22)
+	if _, err := os.Stat(filepath.Join(dir, "history", "ACME.csv")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewMarketDataProviderDefaultsToPythonHelperScript(t *testing.T) {
+	provider, err := NewMarketDataProvider(&config.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extension, ok := provider.(*YahooFinanceExtension)
+	if !ok || extension.yfinScript != DefaultYahooFinanceScript {
+		t.Fatalf("default provider = %#v", provider)
+	}
+}
@@ -0,0 +1,46 @@
+package finance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalculatePeriodicReturnsLinksDailyReturnsByMonth(t *testing.T) {
+	jan := time.Date(2024, time.January, 30, 0, 0, 0, 0, time.UTC)
+	history := map[time.Time]float64{
+		jan:                  1000,
+		jan.AddDate(0, 0, 1): 1100,
+		jan.AddDate(0, 0, 2): 2310,
+		jan.AddDate(0, 0, 3): 2079,
+	}
+	// A purchase on February 1st shouldn't count as a gain.
+	flows := []CashFlow{{Date: jan.AddDate(0, 0, 2).Add(12 * time.Hour), Amount: 1100}}
+
+	returns := CalculatePeriodicReturns(history, flows)
+
+	requireFloat(t, returns.Monthly[2024][1], 10)
+	requireFloat(t, returns.Monthly[2024][2], (1.05*0.9-1)*100)
+	if len(returns.Rolling[1]) != 0 {
+		t.Fatalf("rolling 1-year returns = %v, want none for a short history", returns.Rolling[1])
+	}
+}
+
+func TestCalculatePeriodicReturnsAnnualizesRollingWindows(t *testing.T) {
+	start := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	// A constant 10% annual growth, valued at the start of each year.
+	history := map[time.Time]float64{start: 100}
+	for year := 1; year <= 3; year++ {
+		history[start.AddDate(year, 0, 0)] = history[start.AddDate(year-1, 0, 0)] * 1.1
+	}
+
+	returns := CalculatePeriodicReturns(history, nil)
+
+	if len(returns.Rolling[1]) != 3 || len(returns.Rolling[3]) != 1 || len(returns.Rolling[5]) != 0 {
+		t.Fatalf("rolling windows = %d/%d/%d, want 3/1/0", len(returns.Rolling[1]), len(returns.Rolling[3]), len(returns.Rolling[5]))
+	}
+	requireFloat(t, returns.Rolling[1][0].Return, 10)
+	requireFloat(t, returns.Rolling[3][0].Return, 10)
+	if !returns.Rolling[3][0].Date.Equal(start.AddDate(3, 0, 0)) {
+		t.Fatalf("3-year window ends %v", returns.Rolling[3][0].Date)
+	}
+}
@@ -0,0 +1,46 @@
+package finance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetSnapshotRecordsHeldEquitiesAndCash(t *testing.T) {
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/2/2024", "CASH", "Deposit", "1000", "", "Cash"},
+		{"1/2/2024", "BOLT", "Buy", "5", "20", "Stock"},
+		{"1/2/2024", "ACME", "Buy", "10", "10", "Stock"},
+		{"1/3/2024", "GONE", "Buy", "1", "50", "Stock"},
+	})
+	for ticker, price := range map[string]float64{"ACME": 12, "BOLT": 25} {
+		s := catalogue.equities[ticker]
+		s.CurrentlyHeld = true
+		s.NumShares = s.transactions[0].Shares
+		s.MarketPrice = price
+		s.MarketValue = s.NumShares * price
+		s.TotalCostBasis = s.transactions[0].Value
+	}
+	catalogue.equities["CASH"].MarketValue = 750
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	catalogue.PortfolioHistory[day] = 200
+	catalogue.PortfolioHistory[day.AddDate(0, 0, 1)] = 245
+	catalogue.portfolioSummary.TotalMarketValue = 995
+	catalogue.portfolioSummary.TotalCostBasis = 200
+
+	snapshot := catalogue.GetSnapshot()
+
+	if snapshot.EquityType != "stock" || !snapshot.Date.Equal(day.AddDate(0, 0, 1)) {
+		t.Fatalf("snapshot = %s on %v", snapshot.EquityType, snapshot.Date)
+	}
+	requireFloat(t, snapshot.MarketValue, 995)
+	requireFloat(t, snapshot.Cash, 750)
+	requireFloat(t, snapshot.CostBasis, 200)
+	if len(snapshot.Holdings) != 2 || snapshot.Holdings[0].Ticker != "ACME" || snapshot.Holdings[1].Ticker != "BOLT" {
+		t.Fatalf("holdings = %#v", snapshot.Holdings)
+	}
+	requireFloat(t, snapshot.Holdings[1].Shares, 5)
+	requireFloat(t, snapshot.Holdings[1].Price, 25)
+	requireFloat(t, snapshot.Holdings[1].MarketValue, 125)
+	requireFloat(t, snapshot.Holdings[1].CostBasis, 100)
+}
@@ -0,0 +1,44 @@
+package finance
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+func newTestEmbeddedStore(t *testing.T) *data.EmbeddedStore {
+	store, err := data.NewEmbeddedStore(filepath.Join(t.TempDir(), "polly.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestRefreshStockHistoryStoresPricesInEmbeddedStore(t *testing.T) {
+	store := newTestEmbeddedStore(t)
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	provider := &fakeMarketDataProvider{history: map[string]data.Quote{
+		"ACME": {Date: []time.Time{day.AddDate(0, 0, 1), day}, Close: []float64{11, 10}},
+	}}
+	catalogue := NewEquityCatalogue("stock", nil, store, provider)
+
+	if store.TickerExists("ACME") {
+		t.Fatal("ACME should not exist in an empty store")
+	}
+	catalogue.RefreshStockHistory(&[]Transaction{testTransaction("Buy", 1, 10, day.Add(12*time.Hour))}, false)
+
+	if !store.TickerExists("ACME") || !store.GetLatestQuote("ACME").Equal(day.AddDate(0, 0, 1)) {
+		t.Fatalf("latest ACME quote = %v", store.GetLatestQuote("ACME"))
+	}
+	quote := store.GetTickerData("ACME")
+	if len(quote.Date) != 2 || !quote.Date[0].Equal(day) || quote.Close[1] != 11 {
+		t.Fatalf("ACME history = %#v", quote)
+	}
+	quote = store.GetTickerDataRange("ACME", day.AddDate(0, 0, 1), day.AddDate(0, 0, 5))
+	if len(quote.Date) != 1 || quote.Close[0] != 11 {
+		t.Fatalf("ACME history range = %#v", quote)
+	}
+}
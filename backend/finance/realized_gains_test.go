@@ -0,0 +1,89 @@
+package finance
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsLongTermHoldingRequiresMoreThanOneYear(t *testing.T) {
+	acquired := time.Date(2023, time.March, 15, 12, 0, 0, 0, time.UTC)
+	if isLongTermHolding(acquired, acquired.AddDate(1, 0, 0)) {
+		t.Fatal("sale on the one-year anniversary should be short-term")
+	}
+	if !isLongTermHolding(acquired, acquired.AddDate(1, 0, 1)) {
+		t.Fatal("sale after the one-year anniversary should be long-term")
+	}
+}
+
+func TestSellRecordsClosedLotsByHoldingPeriod(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 10, date),
+		testTransaction("Buy", 10, 20, date.AddDate(1, 0, 0)),
+		testTransaction("Sell", 15, 30, date.AddDate(1, 1, 0)),
+		testTransaction("Sell", 8, 25, date.AddDate(2, 0, 1)),
+	}
+	shares := 0.0
+	for idx := range equity.transactions {
+		shares = equity.CalculateTransactionData(idx, shares)
+	}
+
+	lots := equity.GetClosedLots()
+	if len(lots) != 3 {
+		t.Fatalf("closed lots = %d, want 3 (two lots, one sale each)", len(lots))
+	}
+	if !lots[0].LongTerm || lots[1].LongTerm {
+		t.Fatalf("holding periods = (%v, %v), want (long, short)", lots[0].LongTerm, lots[1].LongTerm)
+	}
+	requireFloat(t, lots[0].Gain, 10*(30-10))
+	requireFloat(t, lots[1].CostBasis, 5*20)
+	requireFloat(t, lots[1].Proceeds, 5*30)
+	if !lots[2].LongTerm || equity.transactions[3].Error == "" {
+		t.Fatalf("second sale should close the last lot and flag the oversold shares: %#v", lots[2:])
+	}
+	totalGain := 0.0
+	for _, lot := range lots {
+		totalGain += lot.Gain
+	}
+	requireFloat(t, totalGain, equity.RealizedGain)
+
+	report2023 := NewRealizedGainsReport(2023, lots)
+	requireFloat(t, report2023.Portfolio.LongTermGain, 200)
+	requireFloat(t, report2023.Portfolio.ShortTermGain, 50)
+	requireFloat(t, report2023.Equities["ACME"].TotalGain, 250)
+	if len(report2023.Lots) != 2 {
+		t.Fatalf("2023 lots = %d, want 2", len(report2023.Lots))
+	}
+	report2024 := NewRealizedGainsReport(2024, lots)
+	requireFloat(t, report2024.Portfolio.LongTermGain, 5*(25-20))
+	requireFloat(t, report2024.Portfolio.ShortTermGain, 0)
+}
+
+func TestWriteForm8949CsvOrdersTermsAndFlagsWashSales(t *testing.T) {
+	sold := time.Date(2024, time.March, 4, 12, 0, 0, 0, time.UTC)
+	report := NewRealizedGainsReport(2024, []ClosedLot{
+		{Ticker: "LONG", Shares: 2, DateAcquired: sold.AddDate(-2, 0, 0), DateSold: sold, Proceeds: 300,
+			CostBasis: 100, Gain: 200, LongTerm: true},
+		{Ticker: "WASH", Shares: 1.5, DateAcquired: sold.AddDate(0, -1, 0), DateSold: sold, Proceeds: 90,
+			CostBasis: 120, Gain: -10, WashSaleDisallowed: 20},
+		{Ticker: "OVER", Shares: 1, DateSold: sold, Proceeds: 10, Gain: 10},
+	})
+	var output strings.Builder
+
+	if err := WriteForm8949Csv(&output, report); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Term,Description,Date Acquired,Date Sold,Proceeds,Cost Basis,Adjustment Code,Adjustment Amount,Gain or Loss\n" +
+		"Short,1 sh OVER,VARIOUS,03/04/2024,10.00,0.00,,,10.00\n" +
+		"Short,1.5 sh WASH,02/04/2024,03/04/2024,90.00,120.00,W,20.00,-10.00\n" +
+		"Long,2 sh LONG,03/04/2022,03/04/2024,300.00,100.00,,,200.00\n"
+	if output.String() != want {
+		t.Fatalf("export =\n%s\nwant\n%s", output.String(), want)
+	}
+}
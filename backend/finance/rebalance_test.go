@@ -0,0 +1,116 @@
+package finance
+
+import (
+	"testing"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+func rebalanceTestEquities(t *testing.T) []*Equity {
+	equities := make([]*Equity, 0)
+	for _, holding := range []struct {
+		ticker string
+		sector string
+		shares float64
+		price  float64
+	}{{"AAA", "Technology", 60, 100}, {"BBB", "Technology", 40, 50}, {"CCC", "Energy", 10, 100}, {"CASH", "", 1000, 1}} {
+		equity, err := NewEquity(holding.ticker, "Stock")
+		if err != nil {
+			t.Fatal(err)
+		}
+		equity.Sector = holding.sector
+		equity.CurrentlyHeld = true
+		equity.MarketPrice = holding.price
+		equity.MarketValue = holding.shares * holding.price
+		equities = append(equities, equity)
+	}
+	return equities
+}
+
+func TestCalculateRebalanceTradesBackToTickerTargets(t *testing.T) {
+	targets := []data.AllocationTarget{
+		{Scope: data.AllocationScopeTicker, Name: "AAA", Weight: 50},
+		{Scope: data.AllocationScopeTicker, Name: "BBB", Weight: 30},
+		{Scope: data.AllocationScopeTicker, Name: "DDD", Weight: 10},
+		{Scope: data.AllocationScopeSector, Name: "Energy", Weight: 90},
+	}
+
+	rebalance, err := CalculateRebalance(rebalanceTestEquities(t), targets, data.AllocationScopeTicker, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requireFloat(t, rebalance.TotalValue, 10000)
+	requireFloat(t, rebalance.Cash, 1000)
+	requireFloat(t, rebalance.CashAfter, 1000)
+	if len(rebalance.Groups) != 4 || rebalance.Groups[2].Name != "CCC" {
+		t.Fatalf("groups = %#v", rebalance.Groups)
+	}
+	requireFloat(t, rebalance.Groups[0].Drift, 10)
+	requireFloat(t, rebalance.Groups[2].TargetWeight, 0)
+	want := []RebalanceTrade{
+		{Group: "AAA", Ticker: "AAA", Action: "Sell", Amount: 1000, Shares: 10},
+		{Group: "BBB", Ticker: "BBB", Action: "Buy", Amount: 1000, Shares: 20},
+		{Group: "CCC", Ticker: "CCC", Action: "Sell", Amount: 1000, Shares: 10},
+		{Group: "DDD", Action: "Buy", Amount: 1000},
+	}
+	if len(rebalance.Trades) != len(want) {
+		t.Fatalf("trades = %#v", rebalance.Trades)
+	}
+	for idx, trade := range rebalance.Trades {
+		if trade.Group != want[idx].Group || trade.Ticker != want[idx].Ticker || trade.Action != want[idx].Action {
+			t.Fatalf("trade %d = %#v, want %#v", idx, trade, want[idx])
+		}
+		requireFloat(t, trade.Amount, want[idx].Amount)
+		requireFloat(t, trade.Shares, want[idx].Shares)
+	}
+
+	rebalance, _ = CalculateRebalance(rebalanceTestEquities(t), targets, data.AllocationScopeTicker, 1500, false)
+	if len(rebalance.Trades) != 0 {
+		t.Fatalf("trades below the minimum = %#v", rebalance.Trades)
+	}
+}
+
+func TestCalculateRebalanceWithoutSellsSplitsCash(t *testing.T) {
+	targets := []data.AllocationTarget{
+		{Scope: data.AllocationScopeTicker, Name: "AAA", Weight: 50},
+		{Scope: data.AllocationScopeTicker, Name: "BBB", Weight: 30},
+		{Scope: data.AllocationScopeTicker, Name: "DDD", Weight: 10},
+	}
+
+	rebalance, err := CalculateRebalance(rebalanceTestEquities(t), targets, data.AllocationScopeTicker, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rebalance.Trades) != 2 || rebalance.Trades[0].Ticker != "BBB" || rebalance.Trades[1].Group != "DDD" {
+		t.Fatalf("trades = %#v", rebalance.Trades)
+	}
+	requireFloat(t, rebalance.Trades[0].Amount, 500)
+	requireFloat(t, rebalance.Trades[1].Amount, 500)
+	requireFloat(t, rebalance.CashAfter, 0)
+}
+
+func TestCalculateRebalanceSplitsSectorTradesAcrossHoldings(t *testing.T) {
+	targets := []data.AllocationTarget{
+		{Scope: data.AllocationScopeSector, Name: "Technology", Weight: 70},
+		{Scope: data.AllocationScopeSector, Name: "Energy", Weight: 20},
+	}
+
+	rebalance, err := CalculateRebalance(rebalanceTestEquities(t), targets, data.AllocationScopeSector, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rebalance.Trades) != 3 || rebalance.Trades[1].Ticker != "AAA" || rebalance.Trades[2].Ticker != "BBB" {
+		t.Fatalf("trades = %#v", rebalance.Trades)
+	}
+	requireFloat(t, rebalance.Trades[0].Amount, 1000)
+	requireFloat(t, rebalance.Trades[1].Amount, 750)
+	requireFloat(t, rebalance.Trades[2].Amount, 250)
+
+	targets = append(targets, data.AllocationTarget{Scope: data.AllocationScopeSector, Name: "Health", Weight: 20})
+	if _, err = CalculateRebalance(rebalanceTestEquities(t), targets, data.AllocationScopeSector, 0, false); err == nil {
+		t.Fatal("expected an error for targets over 100%")
+	}
+}
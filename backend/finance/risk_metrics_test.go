@@ -0,0 +1,55 @@
+package finance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+func TestCalculateRiskMetricsFindsDrawdownAndBeta(t *testing.T) {
+	start := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	benchmarkReturns := []float64{0.01, -0.02, 0.015, -0.005, 0.01, 0.02}
+	benchmark := data.Quote{Date: []time.Time{start}, Close: []float64{100}}
+	history := map[time.Time]float64{start: 1000}
+	for idx, benchReturn := range benchmarkReturns {
+		date := start.AddDate(0, 0, idx+1)
+		benchmark.Date = append(benchmark.Date, date)
+		benchmark.Close = append(benchmark.Close, benchmark.Close[idx]*(1+benchReturn))
+		// The portfolio moves twice as much as the benchmark.
+		history[date] = history[start.AddDate(0, 0, idx)] * (1 + 2*benchReturn)
+	}
+
+	risk := CalculateRiskMetrics(CalculateDailyReturns(history, nil), benchmark, 0.0)
+
+	requireFloat(t, risk.Beta, 2)
+	requireFloat(t, risk.Alpha, 0)
+	// The largest drop is from the first day's peak to the second day, deeper than the later dip.
+	requireFloat(t, risk.MaxDrawdown, -4)
+	if !risk.MaxDrawdownPeak.Equal(start.AddDate(0, 0, 1)) || !risk.MaxDrawdownTrough.Equal(start.AddDate(0, 0, 2)) {
+		t.Fatalf("drawdown peak/trough = %v/%v", risk.MaxDrawdownPeak, risk.MaxDrawdownTrough)
+	}
+	if risk.Volatility <= 0 || risk.SharpeRatio <= 0 || risk.SortinoRatio <= risk.SharpeRatio {
+		t.Fatalf("unexpected volatility/ratios: %#v", risk)
+	}
+}
+
+func TestCalculateRiskMetricsIgnoresPurchasesInHoldingsValue(t *testing.T) {
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/2/2024", "ACME", "Buy", "10", "100", "Stock"},
+		{"1/3/2024", "ACME", "Buy", "10", "100", "Stock"},
+	})
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	history := map[time.Time]float64{day: 1000, day.AddDate(0, 0, 1): 2000, day.AddDate(0, 0, 2): 2000}
+
+	returns := CalculateDailyReturns(history, catalogue.GetHoldingsCashFlows())
+	if len(returns) != 2 {
+		t.Fatalf("daily returns = %d, want 2", len(returns))
+	}
+	requireFloat(t, returns[0].Return, 0)
+
+	risk := CalculateRiskMetrics(returns, data.Quote{}, 0.04)
+	requireFloat(t, risk.MaxDrawdown, 0)
+	requireFloat(t, risk.Beta, 0)
+}
@@ -0,0 +1,51 @@
+package finance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+func TestNewShadowPortfolioReplaysCashFlowsIntoBenchmark(t *testing.T) {
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	benchmark := &Benchmark{Name: "SPY", History: data.Quote{
+		Date:  []time.Time{day, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2), day.AddDate(0, 0, 3)},
+		Close: []float64{100, 110, 120, 130},
+	}}
+	flows := []CashFlow{
+		// A flow on a market holiday trades at the next close.
+		{Date: day.AddDate(0, 0, 2).Add(12 * time.Hour), Amount: -600},
+		{Date: day.AddDate(0, 0, -1).Add(12 * time.Hour), Amount: 1000},
+	}
+	history := map[time.Time]float64{day: 1000, day.AddDate(0, 0, 1): 1050, day.AddDate(0, 0, 2): 500}
+
+	shadow := NewShadowPortfolio(benchmark, flows, history)
+
+	if len(shadow.History) != 3 {
+		t.Fatalf("shadow history has %d dates, want 3", len(shadow.History))
+	}
+	requireFloat(t, shadow.History[day], 1000)
+	requireFloat(t, shadow.History[day.AddDate(0, 0, 1)], 1100)
+	// 10 units, less the 5 units sold at 120, stopping at the portfolio's last date.
+	requireFloat(t, shadow.MarketValue, 600)
+	requireFloat(t, shadow.PortfolioValue, 500)
+	requireFloat(t, shadow.Difference, -100)
+}
+
+func TestGetShadowInputsSelectsFlowSource(t *testing.T) {
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/2/2024", "CASH", "Deposit", "2000", "", "Cash"},
+		{"1/3/2024", "ACME", "Buy", "10", "100", "Stock"},
+	})
+
+	trades, _ := catalogue.GetShadowInputs(ShadowFlowsTrades)
+	if len(trades) != 1 || trades[0].Amount != 1000 {
+		t.Fatalf("trade flows = %v", trades)
+	}
+	deposits, _ := catalogue.GetShadowInputs(ShadowFlowsDeposits)
+	if len(deposits) != 1 || deposits[0].Amount != 2000 {
+		t.Fatalf("deposit flows = %v", deposits)
+	}
+}
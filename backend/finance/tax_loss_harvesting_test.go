@@ -0,0 +1,46 @@
+package finance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindHarvestCandidatesRanksLossesAndFlagsWashSales(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	today := time.Date(2024, time.December, 15, 12, 0, 0, 0, time.UTC)
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 100, today.AddDate(-2, 0, 0)),
+		testTransaction("Buy", 2, 50, today.AddDate(0, -2, 0)),
+		testTransaction("Buy", 5, 80, today.AddDate(0, 0, -10)),
+	}
+	calculateTestTransactions(equity)
+	equity.CurrentlyHeld = true
+	equity.MarketPrice = 60
+
+	report := FindHarvestCandidates([]*Equity{equity}, 0, today)
+
+	if len(report.Candidates) != 2 {
+		t.Fatalf("candidates = %#v", report.Candidates)
+	}
+	first, second := report.Candidates[0], report.Candidates[1]
+	requireFloat(t, first.UnrealizedLoss, -400)
+	requireFloat(t, first.LossPercentage, -40)
+	// Selling the older lot would wash against the recent purchase.
+	if !first.LongTerm || !first.WashSale || !first.LastPurchased.Equal(today.AddDate(0, 0, -10)) {
+		t.Fatalf("first candidate = %#v", first)
+	}
+	requireFloat(t, second.UnrealizedLoss, -100)
+	if second.LongTerm || second.WashSale {
+		t.Fatalf("second candidate = %#v", second)
+	}
+	requireFloat(t, report.LongTermLoss, -400)
+	requireFloat(t, report.ShortTermLoss, -100)
+
+	report = FindHarvestCandidates([]*Equity{equity}, 150, today)
+	if len(report.Candidates) != 1 || report.Candidates[0].Shares != 10 {
+		t.Fatalf("candidates over $150 = %#v", report.Candidates)
+	}
+}
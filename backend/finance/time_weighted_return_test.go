@@ -0,0 +1,74 @@
+package finance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalculateTimeWeightedReturnsLinksDailyReturnsAroundCashFlows(t *testing.T) {
+	day := time.Date(2023, time.December, 29, 0, 0, 0, 0, time.UTC)
+	history := map[time.Time]float64{
+		day:                  100,
+		day.AddDate(0, 0, 1): 110,
+		// A deposit on the weekend is applied at the start of the next valuation date.
+		day.AddDate(0, 0, 4): 231,
+		day.AddDate(0, 0, 5): 115.5,
+	}
+	flows := []CashFlow{
+		{Date: day.Add(12 * time.Hour), Amount: 100},
+		{Date: day.AddDate(0, 0, 5).Add(12 * time.Hour), Amount: -115.5},
+		{Date: day.AddDate(0, 0, 2).Add(12 * time.Hour), Amount: 100},
+	}
+
+	twr := CalculateTimeWeightedReturns(history, flows)
+
+	// The initial deposit is part of the starting value, so doesn't count as a flow.
+	requireFloat(t, twr.Annual[2023], 10)
+	requireFloat(t, twr.Annual[2024], 10)
+	requireFloat(t, twr.SinceInception, 21)
+	requireFloat(t, twr.AnnualizedInception, 21)
+}
+
+func TestCalculateTimeWeightedReturnsHandlesShortHistory(t *testing.T) {
+	twr := CalculateTimeWeightedReturns(map[time.Time]float64{time.Now(): 100}, nil)
+	if len(twr.Annual) != 0 || twr.SinceInception != 0 {
+		t.Fatalf("unexpected returns for a single value: %#v", twr)
+	}
+}
+
+func TestCombineValueHistoriesCarriesValuesForward(t *testing.T) {
+	friday := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)
+	stocks := map[time.Time]float64{friday: 100, friday.AddDate(0, 0, 3): 105}
+	crypto := map[time.Time]float64{friday: 10, friday.AddDate(0, 0, 1): 11, friday.AddDate(0, 0, 3): 12}
+
+	combined := CombineValueHistories(stocks, crypto)
+
+	if len(combined) != 3 {
+		t.Fatalf("combined dates = %d, want 3", len(combined))
+	}
+	requireFloat(t, combined[friday.AddDate(0, 0, 1)], 111)
+	requireFloat(t, combined[friday.AddDate(0, 0, 3)], 117)
+}
+
+func TestGetValueHistoryAddsCashBalanceAndFlows(t *testing.T) {
+	catalogue := NewEquityCatalogue("stock", nil, nil, nil)
+	catalogue.ProcessImport([][]interface{}{
+		{"1/2/2024", "CASH", "Deposit", "1000", "", "Cash"},
+		{"1/2/2024", "ACME", "Buy", "10", "50", "Stock"},
+		{"1/4/2024", "CASH", "Withdraw", "100", "", "Cash"},
+	})
+	catalogue.CalculateCashBalanceHistory()
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)
+	catalogue.PortfolioHistory = map[time.Time]float64{day: 500, day.AddDate(0, 0, 1): 550, day.AddDate(0, 0, 2): 600}
+
+	history := catalogue.GetValueHistory()
+	requireFloat(t, history[day], 1000)
+	requireFloat(t, history[day.AddDate(0, 0, 1)], 1050)
+	requireFloat(t, history[day.AddDate(0, 0, 2)], 1000)
+
+	flows := catalogue.GetExternalCashFlows()
+	if len(flows) != 2 {
+		t.Fatalf("cash flows = %d, want 2", len(flows))
+	}
+	requireFloat(t, flows[1].Amount, -100)
+}
@@ -37,3 +37,12 @@ func TestNewTransactionDefaultsBlankPriceToOne(t *testing.T) {
 		t.Fatalf("blank-price transaction = price %v, value %v; want price 1, value 2500", txn.Price, txn.Value)
 	}
 }
+
+func TestNewTransactionAcceptsIncomeAndFeeActions(t *testing.T) {
+	for _, action := range []string{"Dividend", "ReinvestedDividend", "Interest", "Fee"} {
+		txn := NewTransaction("1/1/2024", "ACME", action, "12.5", "")
+		if txn.Action != action || txn.Value != 12.5 {
+			t.Fatalf("%s transaction = action %q, value %v; want value 12.5", action, txn.Action, txn.Value)
+		}
+	}
+}
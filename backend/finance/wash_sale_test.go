@@ -0,0 +1,115 @@
+package finance
+
+import (
+	"testing"
+	"time"
+)
+
+func calculateTestTransactions(equity *Equity) float64 {
+	shares := 0.0
+	for idx := range equity.transactions {
+		shares = equity.CalculateTransactionData(idx, shares)
+	}
+	return shares
+}
+
+func TestWashSaleRollsLossIntoLaterReplacementLot(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, time.January, 2, 12, 0, 0, 0, time.UTC)
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 50, date),
+		testTransaction("Sell", 10, 40, date.AddDate(0, 2, 0)),
+		testTransaction("Buy", 4, 38, date.AddDate(0, 2, 20)),
+		// Outside the 30-day window, so not a replacement.
+		testTransaction("Buy", 5, 39, date.AddDate(0, 4, 0)),
+	}
+
+	calculateTestTransactions(equity)
+
+	sale := equity.transactions[1]
+	if !sale.WashSale {
+		t.Fatal("sale should be flagged as a wash sale")
+	}
+	requireFloat(t, sale.WashSaleDisallowed, 40)
+	requireFloat(t, equity.RealizedGain, -100+40)
+	requireFloat(t, equity.transactions[2].BasisAdjustment, 40)
+	requireFloat(t, equity.transactions[3].BasisAdjustment, 0)
+	requireFloat(t, equity.buyQ[0].Price, 38+10)
+	requireFloat(t, equity.closedLots[0].Gain, -60)
+	requireFloat(t, equity.closedLots[0].WashSaleDisallowed, 40)
+}
+
+func TestWashSaleUsesEarlierReplacementLotOnce(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, time.January, 2, 12, 0, 0, 0, time.UTC)
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 50, date),
+		testTransaction("Buy", 5, 45, date.AddDate(0, 2, 0)),
+		testTransaction("Sell", 5, 40, date.AddDate(0, 2, 10)),
+		testTransaction("Sell", 5, 40, date.AddDate(0, 2, 11)),
+	}
+
+	calculateTestTransactions(equity)
+
+	requireFloat(t, equity.transactions[2].WashSaleDisallowed, 50)
+	// The replacement lot was already used by the first sale.
+	if equity.transactions[3].WashSale {
+		t.Fatal("second sale should not reuse the replacement shares")
+	}
+	requireFloat(t, equity.transactions[1].BasisAdjustment, 50)
+	requireFloat(t, equity.RealizedGain, -50)
+}
+
+func TestWashSaleIgnoresGainsAndResetsOnRecalculation(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, time.January, 2, 12, 0, 0, 0, time.UTC)
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 50, date),
+		testTransaction("Sell", 10, 60, date.AddDate(0, 0, 5)),
+		testTransaction("Buy", 10, 55, date.AddDate(0, 0, 10)),
+	}
+
+	calculateTestTransactions(equity)
+	if equity.transactions[1].WashSale {
+		t.Fatal("sale at a gain is not a wash sale")
+	}
+
+	equity.transactions[1].Price = 40
+	equity.resetCalculatedMetrics()
+	calculateTestTransactions(equity)
+	equity.resetCalculatedMetrics()
+	calculateTestTransactions(equity)
+	requireFloat(t, equity.transactions[1].WashSaleDisallowed, 100)
+	requireFloat(t, equity.transactions[2].BasisAdjustment, 100)
+}
+
+func TestWashSaleIgnoresUnsoldSharesOfTheLotSold(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, time.January, 2, 12, 0, 0, 0, time.UTC)
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 100, 50, date),
+		testTransaction("Sell", 50, 40, date.AddDate(0, 0, 10)),
+	}
+
+	calculateTestTransactions(equity)
+
+	sale := equity.transactions[1]
+	if sale.WashSale {
+		t.Fatal("partial sale of a lot should not be a wash sale")
+	}
+	requireFloat(t, sale.WashSaleDisallowed, 0)
+	requireFloat(t, equity.RealizedGain, -500)
+	requireFloat(t, equity.buyQ[0].Price, 50)
+}
@@ -0,0 +1,65 @@
+package finance
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCalculateXirrMatchesSpreadsheetResult(t *testing.T) {
+	flows := []CashFlow{
+		{Date: time.Date(2008, time.January, 1, 0, 0, 0, 0, time.UTC), Amount: -10000},
+		{Date: time.Date(2008, time.March, 1, 0, 0, 0, 0, time.UTC), Amount: 2750},
+		{Date: time.Date(2008, time.October, 30, 0, 0, 0, 0, time.UTC), Amount: 4250},
+		{Date: time.Date(2009, time.February, 15, 0, 0, 0, 0, time.UTC), Amount: 3250},
+		{Date: time.Date(2009, time.April, 1, 0, 0, 0, 0, time.UTC), Amount: 2750},
+	}
+
+	rate, err := CalculateXirr(flows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(rate-0.373362535) > 0.000001 {
+		t.Fatalf("XIRR = %v, want 0.373362535", rate)
+	}
+}
+
+func TestCalculateXirrHandlesLossesAndRejectsOneSidedFlows(t *testing.T) {
+	start := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	rate, err := CalculateXirr([]CashFlow{{Date: start, Amount: -1000}, {Date: start.AddDate(1, 0, 0), Amount: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireFloat(t, math.Round(rate*1e6)/1e6, -0.9)
+
+	if _, err = CalculateXirr([]CashFlow{{Date: start, Amount: -1000}}); err == nil {
+		t.Fatal("XIRR without a positive flow should return an error")
+	}
+}
+
+func TestEquityInvestmentCashFlowsIncludeTradesAndIncome(t *testing.T) {
+	equity, err := NewEquity("ACME", "Stock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2023, time.January, 1, 12, 0, 0, 0, time.UTC)
+	equity.transactions = []Transaction{
+		testTransaction("Buy", 10, 100, start),
+		testTransaction("Dividend", 50, 1, start.AddDate(0, 6, 0)),
+		testTransaction("ReinvestedDividend", 0.5, 100, start.AddDate(0, 9, 0)),
+		testTransaction("Sell", 5, 110, start.AddDate(1, 0, 0)),
+	}
+	calculateTestTransactions(equity)
+
+	flows := equity.GetInvestmentCashFlows()
+	if len(flows) != 3 {
+		t.Fatalf("investment flows = %d, want buy, dividend and sale", len(flows))
+	}
+	requireFloat(t, flows[0].Amount, -1000)
+	requireFloat(t, flows[2].Amount, 550)
+	// Valuing the remaining 5.5 shares at $110 a year after the purchase.
+	mwr := CalculateMoneyWeightedReturn(flows, 5.5*110, start.AddDate(1, 0, 0))
+	if mwr < 20.9 || mwr > 21.1 {
+		t.Fatalf("money-weighted return = %v%%, want about 21%%", mwr)
+	}
+}
@@ -0,0 +1,122 @@
+package finance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kfwalther/Polly/backend/data"
+)
+
+func newTestYahooServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cookie", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "A3", Value: "session"})
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/v1/test/getcrumb", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("A3"); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("testcrumb"))
+	})
+	mux.HandleFunc("/v10/finance/quoteSummary/ACME", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("crumb") != "testcrumb" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"quoteSummary":{"result":[{
+			"financialData":{"currentPrice":{"raw":25.5,"fmt":"25.50"},"grossMargins":{"raw":0.6,"fmt":"60%"}},
+			"summaryDetail":{"previousClose":{"raw":24.0,"fmt":"24.00"},"trailingPE":{}},
+			"assetProfile":{"sector":"Technology","industry":"Software"}
+		}],"error":null}}`))
+	})
+	mux.HandleFunc("/v8/finance/chart/ACME", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"chart":{"result":[{
+			"meta":{"symbol":"ACME","gmtoffset":-18000},
+			"timestamp":[1704205800,1704292200,1704378600],
+			"events":{"splits":{
+				"1717767000":{"date":1717767000,"numerator":10,"denominator":1,"splitRatio":"10:1"},
+				"1621863000":{"date":1621863000,"numerator":1,"denominator":2,"splitRatio":"1:2"}}},
+			"indicators":{"quote":[{
+				"open":[10,11,null],"high":[12,13,null],"low":[9,10,null],
+				"close":[11,12,null],"volume":[1000,2000,null]}]}
+		}],"error":null}}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestYahooFinanceClient(server *httptest.Server) *YahooFinanceClient {
+	client := NewYahooFinanceClient()
+	client.baseUrl = server.URL
+	client.cookieUrl = server.URL + "/cookie"
+	return client
+}
+
+func TestYahooFinanceClientGetTickerDataFlattensModules(t *testing.T) {
+	client := newTestYahooFinanceClient(newTestYahooServer(t))
+
+	result := client.GetTickerData("ACME")
+
+	info, ok := (*result)["ACME"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("ACME info missing from result: %v", *result)
+	}
+	requireFloat(t, info["currentPrice"].(float64), 25.5)
+	requireFloat(t, info["previousClose"].(float64), 24)
+	requireFloat(t, info["grossMargins"].(float64), 0.6)
+	if info["sector"] != "Technology" || info["industry"] != "Software" {
+		t.Fatalf("profile = (%v, %v), want (Technology, Software)", info["sector"], info["industry"])
+	}
+	if _, exists := info["trailingPE"]; exists {
+		t.Fatal("empty values should not be flattened into the info map")
+	}
+}
+
+func TestYahooFinanceClientGetHistoricalDataSkipsMissingCloses(t *testing.T) {
+	client := newTestYahooFinanceClient(newTestYahooServer(t))
+
+	quote, err := client.GetHistoricalData("ACME", "2024-01-02", "2024-01-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if quote.Symbol != "ACME" {
+		t.Fatalf("Symbol = %q, want ACME", quote.Symbol)
+	}
+	if len(quote.Date) != 2 || len(quote.Close) != 2 || len(quote.Volume) != 2 {
+		t.Fatalf("bars = %d, want 2", len(quote.Date))
+	}
+	wantDate := time.Date(2024, time.January, 3, 0, 0, 0, 0, time.UTC)
+	if !quote.Date[1].Equal(wantDate) {
+		t.Fatalf("Date[1] = %v, want %v", quote.Date[1], wantDate)
+	}
+	requireFloat(t, quote.Open[0], 10)
+	requireFloat(t, quote.Close[1], 12)
+	requireFloat(t, quote.Volume[1], 2000)
+}
+
+func TestYahooFinanceClientGetSplitHistoryOrdersSplitsByDate(t *testing.T) {
+	client := newTestYahooFinanceClient(newTestYahooServer(t))
+
+	splits, err := client.GetSplitHistory("ACME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(splits) != 2 {
+		t.Fatalf("splits = %d, want 2", len(splits))
+	}
+	if !splits[0].Date.Equal(time.Date(2021, time.May, 24, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("first split date = %v, want 2021-05-24 UTC", splits[0].Date)
+	}
+	requireFloat(t, splits[0].Ratio, 0.5)
+	requireFloat(t, splits[1].Ratio, 10)
+	if splits[1].Ticker != "ACME" || splits[1].Type != data.CorporateActionSplit {
+		t.Fatalf("unexpected split action: %#v", splits[1])
+	}
+}
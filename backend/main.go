@@ -2,6 +2,7 @@ package main
 
 // List of imported packages
 import (
+	"flag"
 	"log"
 	"os"
 
@@ -10,13 +11,22 @@ import (
 	"github.com/kfwalther/Polly/backend/auth"
 	"github.com/kfwalther/Polly/backend/config"
 	"github.com/kfwalther/Polly/backend/controllers"
+	"github.com/kfwalther/Polly/backend/data"
+	"github.com/kfwalther/Polly/backend/finance"
 	"golang.org/x/oauth2/google"
 )
 
 // Program entry point.
 func main() {
+	// Optionally run a one-off maintenance task instead of the web server.
+	dedupe := flag.Bool("dedupe", false, "remove duplicate quotes from the price history, then exit")
+	flag.Parse()
 	// Read the config file for this server.
 	config := config.NewConfiguration("../go-server-config.json")
+	if *dedupe {
+		removeDuplicateQuotes(config)
+		return
+	}
 	// Get the GCP credentials file.
 	b, err := os.ReadFile(config.GcpCredentialsFile)
 	if err != nil {
@@ -32,10 +42,18 @@ func main() {
 	tokenFile := config.AuthTokenFile
 	// Create a new OAuth handler to manage OAuth with Google Sheets API.
 	oauthHandler := auth.NewOAuthHandler(tokenFile, oauthConfig)
-	// Name the python script to use with yfinance to grab extended stock info.
-	pyScript := "yahooFinanceHelper.py"
+	// Create the market data provider (Python yfinance bridge or native Go client) to grab stock info.
+	marketData, err := finance.NewMarketDataProvider(config)
+	if err != nil {
+		log.Fatalf("Unable to create market data provider: %v", err)
+	}
+	// Connect to the store (MongoDB or an embedded file) housing price history and our settings.
+	store, err := data.NewStore(config)
+	if err != nil {
+		log.Fatalf("Unable to open the data store: %v", err)
+	}
 	// Create a controller to manage front-end interaction.
-	ctrlr := controllers.NewPortfolioController(oauthHandler, config.GoogleSheetsIdsFile, pyScript)
+	ctrlr := controllers.NewPortfolioController(oauthHandler, config.GoogleSheetsIdsFile, marketData, store)
 	ctrlr.Init(config)
 
 	// Set gin web server to release mode. Comment out to enable debug logging.
@@ -54,8 +72,65 @@ func main() {
 		equityType := c.Param("equitytype")
 		ctrlr.GetSummary(c, equityType)
 	})
+	router.GET("/risk/:equitytype", func(c *gin.Context) {
+		equityType := c.Param("equitytype")
+		ctrlr.GetRiskMetrics(c, equityType)
+	})
+	router.GET("/attribution/:equitytype", func(c *gin.Context) {
+		equityType := c.Param("equitytype")
+		ctrlr.GetAttribution(c, equityType)
+	})
+	router.GET("/diversification/:equitytype", func(c *gin.Context) {
+		equityType := c.Param("equitytype")
+		ctrlr.GetDiversification(c, equityType)
+	})
+	router.GET("/returns/:equitytype", func(c *gin.Context) {
+		equityType := c.Param("equitytype")
+		ctrlr.GetPeriodicReturns(c, equityType)
+	})
+	router.GET("/shadow/:equitytype", func(c *gin.Context) {
+		equityType := c.Param("equitytype")
+		ctrlr.GetShadowPortfolios(c, equityType)
+	})
 	router.GET("/transactions", ctrlr.GetTransactions)
+	router.GET("/gains/:year", func(c *gin.Context) {
+		year := c.Param("year")
+		ctrlr.GetRealizedGains(c, year)
+	})
+	router.GET("/gains/:year/8949", func(c *gin.Context) {
+		year := c.Param("year")
+		ctrlr.GetForm8949Export(c, year)
+	})
+	router.GET("/harvest", ctrlr.GetHarvestCandidates)
+	router.GET("/corporateactions", ctrlr.GetCorporateActions)
+	router.POST("/corporateactions", ctrlr.CreateCorporateAction)
+	router.PUT("/corporateactions/:id", func(c *gin.Context) {
+		ctrlr.UpdateCorporateAction(c, c.Param("id"))
+	})
+	router.DELETE("/corporateactions/:id", func(c *gin.Context) {
+		ctrlr.DeleteCorporateAction(c, c.Param("id"))
+	})
+	router.GET("/targets", ctrlr.GetAllocationTargets)
+	router.POST("/targets", ctrlr.CreateAllocationTarget)
+	router.PUT("/targets/:id", func(c *gin.Context) {
+		ctrlr.UpdateAllocationTarget(c, c.Param("id"))
+	})
+	router.DELETE("/targets/:id", func(c *gin.Context) {
+		ctrlr.DeleteAllocationTarget(c, c.Param("id"))
+	})
+	router.GET("/rebalance/:equitytype", func(c *gin.Context) {
+		equityType := c.Param("equitytype")
+		ctrlr.GetRebalance(c, equityType)
+	})
+	router.GET("/snapshots/:equitytype", func(c *gin.Context) {
+		equityType := c.Param("equitytype")
+		ctrlr.GetSnapshots(c, equityType)
+	})
 	router.GET("/sp500", ctrlr.GetSp500History)
+	router.GET("/prices/:ticker", func(c *gin.Context) {
+		ctrlr.GetPriceHistory(c, c.Param("ticker"))
+	})
+	router.GET("/benchmarks", ctrlr.GetBenchmarks)
 	router.GET("/history", ctrlr.GetPortfolioHistory)
 	router.GET("/refresh", ctrlr.WebSocketHandler)
 	router.GET("/tokenresponse", ctrlr.OAuthRedirectCallback)
@@ -65,3 +140,21 @@ func main() {
 	// Run the web server.
 	router.Run(":" + config.WebServerPort)
 }
+
+// Remove duplicate quotes from the configured store's price history.
+func removeDuplicateQuotes(config *config.Configuration) {
+	store, err := data.NewStore(config)
+	if err != nil {
+		log.Fatalf("Unable to open the data store: %v", err)
+	}
+	deduplicator, ok := store.(data.QuoteDeduplicator)
+	if !ok {
+		log.Print("The configured store can't hold duplicate quotes, nothing to remove.")
+		return
+	}
+	removed, err := deduplicator.RemoveDuplicateQuotes()
+	if err != nil {
+		log.Fatalf("Unable to remove duplicate quotes: %v", err)
+	}
+	log.Printf("Removed %d duplicate quotes.", removed)
+}
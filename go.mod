@@ -6,6 +6,7 @@ require (
 	github.com/gin-contrib/cors v1.4.0
 	github.com/gin-gonic/gin v1.9.0
 	github.com/gorilla/websocket v1.5.0
+	go.etcd.io/bbolt v1.3.7
 	go.mongodb.org/mongo-driver v1.11.3
 	golang.org/x/exp v0.0.0-20220907003533-145caa8ea1d0
 	golang.org/x/oauth2 v0.0.0-20220822191816-0ebed06d0094
@@ -71,6 +71,15 @@ export function TransactionsTable({ txnData }) {
                     </div>,
                 sortType: 'basic',
             },
+            {
+                Header: 'Wash Sale Disallowed',
+                accessor: 'washSaleDisallowed',
+                Cell: props =>
+                    <div style={{ color: TABLE_RED }} >
+                        {props.value > 0 ? toUSD(props.value) : ''}
+                    </div>,
+                sortType: 'basic',
+            },
         ], []
     );
 